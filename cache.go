@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// cacheDir returns the root directory used to cache downloaded artifacts, it
+// can be overridden using $EXTISM_CACHE_DIR
+func cacheDir() (string, error) {
+	if dir := os.Getenv("EXTISM_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "extism"), nil
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// defaultWasmTTL is how long a module fetched from a URL without a hash is used
+// before it's downloaded again, it can be overridden using $EXTISM_WASM_TTL
+const defaultWasmTTL = 24 * time.Hour
+
+// wasmCache is a content-addressed store for Wasm modules fetched from URLs,
+// modules are stored by sha256 and an index maps each URL to the hash of the
+// most recently fetched module
+type wasmCache struct {
+	dir string
+}
+
+type wasmCacheEntry struct {
+	Hash    string    `json:"hash"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func wasmTTL() time.Duration {
+	if s := os.Getenv("EXTISM_WASM_TTL"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err == nil {
+			return ttl
+		}
+		Log("Ignoring invalid EXTISM_WASM_TTL:", err)
+	}
+	return defaultWasmTTL
+}
+
+func newWasmCache() (*wasmCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "wasm")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &wasmCache{dir: dir}, nil
+}
+
+func (c *wasmCache) path(hash string) string {
+	return filepath.Join(c.dir, hash+".wasm")
+}
+
+func (c *wasmCache) indexPath() string {
+	return filepath.Join(c.dir, "urls.json")
+}
+
+func (c *wasmCache) readIndex() map[string]wasmCacheEntry {
+	index := map[string]wasmCacheEntry{}
+	data, err := os.ReadFile(c.indexPath())
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		// Older indexes only stored the hash, those entries are treated as
+		// expired
+		hashes := map[string]string{}
+		if json.Unmarshal(data, &hashes) != nil {
+			Log("Ignoring invalid cache index:", err)
+			return index
+		}
+		for url, hash := range hashes {
+			index[url] = wasmCacheEntry{Hash: hash}
+		}
+	}
+	return index
+}
+
+func (c *wasmCache) writeIndex(index map[string]wasmCacheEntry) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.indexPath(), data, 0o644)
+}
+
+// get returns the cached module with the given hash
+func (c *wasmCache) get(hash string) ([]byte, bool) {
+	if hash == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(hash))
+	if err != nil {
+		return nil, false
+	}
+	if sha256Hex(data) != hash {
+		Log("Ignoring corrupted cache entry:", c.path(hash))
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *wasmCache) put(url string, data []byte) (string, error) {
+	hash := sha256Hex(data)
+	if err := writeFileAtomic(c.path(hash), data, 0o644); err != nil {
+		return hash, err
+	}
+	index := c.readIndex()
+	index[url] = wasmCacheEntry{Hash: hash, Fetched: time.Now().UTC()}
+	return hash, c.writeIndex(index)
+}
+
+func downloadWasm(ctx context.Context, u extism.WasmUrl) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, u.Method, u.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range u.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", u.Url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// fetch returns the module referenced by u, using the cache when possible.
+// Modules without a hash are downloaded again once the cached copy is older
+// than the TTL or when refresh is set. When offline is set only cached modules
+// are used
+func (c *wasmCache) fetch(ctx context.Context, u extism.WasmUrl, offline, refresh bool) ([]byte, error) {
+	// A module with a known hash never needs to be downloaded again
+	if data, ok := c.get(u.Hash); ok {
+		Log("Using cached module for", u.Url)
+		return data, nil
+	}
+
+	entry := c.readIndex()[u.Url]
+	cached, cachedOk := c.get(entry.Hash)
+	if cachedOk && u.Hash != "" {
+		// The cached module is out of date
+		cachedOk = false
+	}
+
+	if offline {
+		if !cachedOk {
+			return nil, fmt.Errorf("module %s is not cached, run `extism fetch` before using --offline", u.Url)
+		}
+		Log("Using cached module for", u.Url)
+		return cached, nil
+	}
+
+	if cachedOk && !refresh && time.Since(entry.Fetched) < wasmTTL() {
+		Log("Using module for", u.Url, "cached at", entry.Fetched.Format(time.RFC3339))
+		return cached, nil
+	}
+
+	Log("Fetching", u.Url)
+	data, err := downloadWasm(ctx, u)
+	if err != nil {
+		// A stale copy is only used when a download wasn't requested explicitly
+		if cachedOk && !refresh {
+			Log("Unable to fetch", u.Url, "using cached module:", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if u.Hash != "" && sha256Hex(data) != u.Hash {
+		return nil, fmt.Errorf("hash mismatch for %s: expected %s, got %s", u.Url, u.Hash, sha256Hex(data))
+	}
+
+	hash, err := c.put(u.Url, data)
+	if err != nil {
+		return nil, err
+	}
+	Log("Cached", u.Url, "as", hash)
+	return data, nil
+}
+
+// resolveWasm replaces URL modules with their cached contents
+func resolveWasm(ctx context.Context, modules []extism.Wasm, offline, refresh bool) ([]extism.Wasm, error) {
+	var cache *wasmCache
+	resolved := make([]extism.Wasm, 0, len(modules))
+	for _, w := range modules {
+		u, ok := w.(extism.WasmUrl)
+		if !ok {
+			resolved = append(resolved, w)
+			continue
+		}
+
+		if cache == nil {
+			var err error
+			cache, err = newWasmCache()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		data, err := cache.fetch(ctx, u, offline, refresh)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, extism.WasmData{Data: data, Hash: u.Hash, Name: u.Name})
+	}
+	return resolved, nil
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and renames
+// it into place so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+type fetchArgs struct {
+	callArgs
+}
+
+func runFetch(cmd *cobra.Command, fetch *fetchArgs) error {
+	// With --manifest the arguments are manifest files instead of URLs, like
+	// `extism call`
+	manifests := fetch.manifests
+	urls := fetch.args
+	if fetch.manifest {
+		manifests = append(append([]string{}, fetch.args...), fetch.manifests...)
+		urls = nil
+	}
+
+	manifest := extism.Manifest{}
+	if len(manifests) > 0 {
+		var err error
+		manifest, err = loadManifests(manifests)
+		if err != nil {
+			return err
+		}
+	}
+	manifest.Wasm = append(manifest.Wasm, fetch.getLinkModules()...)
+	for _, url := range urls {
+		manifest.Wasm = append(manifest.Wasm, extism.WasmUrl{Url: url})
+	}
+
+	cache, err := newWasmCache()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, w := range manifest.Wasm {
+		u, ok := w.(extism.WasmUrl)
+		if !ok {
+			continue
+		}
+		// Fetching always downloads the latest version of each module
+		data, err := cache.fetch(cmd.Context(), u, false, true)
+		if err != nil {
+			return err
+		}
+		Print(u.Url, sha256Hex(data))
+		count++
+	}
+
+	if count == 0 {
+		return errors.New("no URL modules found to fetch")
+	}
+	return nil
+}
+
+func FetchCmd() *cobra.Command {
+	fetch := &fetchArgs{}
+	cmd := &cobra.Command{
+		Use:          "fetch [flags] [url... | manifest_file...]",
+		Short:        "Download Wasm modules into the local cache for offline use",
+		SilenceUsage: true,
+		RunE:         RunArgs(runFetch, fetch),
+	}
+	flags := cmd.Flags()
+	flags.BoolVarP(&fetch.manifest, "manifest", "m", false, "When set the arguments are parsed as JSON, YAML or TOML encoded Extism manifests and all URL modules they list are fetched")
+	flags.StringArrayVar(&fetch.manifests, "manifest-file", []string{}, "Load a JSON, YAML or TOML encoded Extism manifest, may be repeated to merge multiple manifests, ${VAR} is replaced with environment variables in YAML and TOML manifests")
+	flags.StringArrayVar(&fetch.link, "link", []string{}, "Additional modules to fetch")
+	return cmd
+}
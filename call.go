@@ -21,6 +21,8 @@ type callArgs struct {
 	loop                  int
 	wasi                  bool
 	logLevel              string
+	logFormat             string
+	logFile               string
 	allowedPaths          []string
 	allowedHosts          []string
 	enableHttpRespHeaders bool
@@ -31,8 +33,21 @@ type callArgs struct {
 	config                []string
 	setConfig             string
 	manifest              bool
+	manifests             []string
 	stdin                 bool
 	link                  []string
+	env                   []string
+	wasiArgs              []string
+	wasiStdin             string
+	wasiStdout            string
+	wasiStderr            string
+	files                 map[string]*os.File
+	offline               bool
+	refresh               bool
+	requireSignature      bool
+	trustedKeys           []string
+	then                  []string
+	schema                string
 }
 
 func readStdin() []byte {
@@ -58,14 +73,21 @@ func (a *callArgs) SetArgs(args []string) {
 func (a *callArgs) getAllowedPaths() map[string]string {
 	allowedPaths := map[string]string{}
 	for _, path := range a.allowedPaths {
+		// Read-only mounts are prefixed with `ro:`, the prefix is kept on the
+		// host path in the manifest
+		prefix := ""
+		if strings.HasPrefix(path, "ro:") {
+			prefix = "ro:"
+			path = strings.TrimPrefix(path, "ro:")
+		}
 		split := strings.Split(path, ":")
 		switch len(split) {
 		case 1:
-			allowedPaths[path] = path
+			allowedPaths[prefix+path] = path
 		case 2:
-			allowedPaths[split[0]] = split[1]
+			allowedPaths[prefix+split[0]] = split[1]
 		default:
-			allowedPaths[split[0]] = strings.Join(split[1:], ":")
+			allowedPaths[prefix+split[0]] = strings.Join(split[1:], ":")
 		}
 	}
 	return allowedPaths
@@ -123,58 +145,69 @@ func (a *callArgs) getLinkModules() []extism.Wasm {
 }
 
 var globalPlugin *extism.Plugin
+var globalPluginKey string
+
+// pluginKey identifies the options used to create a plugin, the global plugin
+// is only reused when it was created with the same options
+func (a *callArgs) pluginKey(manifest extism.Manifest) string {
+	data, _ := json.Marshal(struct {
+		Manifest              extism.Manifest
+		Wasi                  bool
+		Env                   []string
+		WasiArgs              []string
+		WasiStdio             []string
+		EnableHttpRespHeaders bool
+		RequireSignature      bool
+		TrustedKeys           []string
+	}{manifest, a.wasi, a.env, a.wasiArgs, []string{a.wasiStdin, a.wasiStdout, a.wasiStderr}, a.enableHttpRespHeaders, a.requireSignature, a.trustedKeys})
+	return string(data)
+}
 
-func runCall(cmd *cobra.Command, call *callArgs) error {
-	if len(call.args) < 1 {
-		return errors.New("an input file is required")
-	} else if len(call.args) < 2 {
-		return errors.New("a function name is required")
+// manifestFiles returns the manifests to load, with --manifest the wasm
+// argument is a manifest and any --manifest-file is layered on top of it
+func (a *callArgs) manifestFiles(wasm string) (string, []string) {
+	if a.manifest && wasm != "" {
+		return "", append([]string{wasm}, a.manifests...)
 	}
+	return wasm, a.manifests
+}
 
-	ctx := context.Background()
-	wasm := call.args[0]
-	funcName := call.args[1]
-
-	// Manifest
+func (a *callArgs) getManifest(wasm string) (extism.Manifest, error) {
 	var manifest extism.Manifest
-	if call.manifest {
-		Log("Reading from manifest:", wasm)
-		f, err := os.Open(wasm)
-		if err != nil {
-			return err
-		}
-		err = json.NewDecoder(f).Decode(&manifest)
+	wasm, manifests := a.manifestFiles(wasm)
+	if len(manifests) > 0 {
+		var err error
+		manifest, err = loadManifests(manifests)
 		if err != nil {
-			return err
+			return manifest, err
 		}
 
 		// Link additional modules from CLI
-		manifest.Wasm = append(call.getLinkModules(), manifest.Wasm...)
-
-		Log("Read manifest:", manifest)
-		defer f.Close()
+		manifest.Wasm = append(a.getLinkModules(), manifest.Wasm...)
 	} else {
-		manifest.Wasm = call.getLinkModules()
+		manifest.Wasm = a.getLinkModules()
+	}
 
-		if strings.HasPrefix(wasm, "http://") || strings.HasPrefix(wasm, "https://") {
-			Log("Loading wasm file as url:", wasm)
-			manifest.Wasm = append(manifest.Wasm, extism.WasmUrl{Url: wasm})
-		} else {
-			Log("Adding wasm file to manifest:", wasm)
-			manifest.Wasm = append(manifest.Wasm, extism.WasmFile{Path: wasm})
-		}
+	// When a wasm file is passed along with manifests it is used as the main
+	// module
+	if strings.HasPrefix(wasm, "http://") || strings.HasPrefix(wasm, "https://") {
+		Log("Loading wasm file as url:", wasm)
+		manifest.Wasm = append(manifest.Wasm, extism.WasmUrl{Url: wasm})
+	} else if wasm != "" {
+		Log("Adding wasm file to manifest:", wasm)
+		manifest.Wasm = append(manifest.Wasm, extism.WasmFile{Path: wasm})
 	}
 
 	// Allowed hosts
-	Log("Adding allowed hosts:", call.allowedHosts)
-	manifest.AllowedHosts = append(manifest.AllowedHosts, call.allowedHosts...)
+	Log("Adding allowed hosts:", a.allowedHosts)
+	manifest.AllowedHosts = append(manifest.AllowedHosts, a.allowedHosts...)
 
 	// Allowed paths
 	if manifest.AllowedPaths == nil {
 		manifest.AllowedPaths = map[string]string{}
 	}
 
-	for k, v := range call.getAllowedPaths() {
+	for k, v := range a.getAllowedPaths() {
 		Log("Adding path mapping:", k+":"+v)
 		manifest.AllowedPaths[k] = v
 	}
@@ -183,9 +216,9 @@ func runCall(cmd *cobra.Command, call *callArgs) error {
 	if manifest.Config == nil {
 		manifest.Config = map[string]string{}
 	}
-	config, err := call.getConfig()
+	config, err := a.getConfig()
 	if err != nil {
-		return err
+		return manifest, err
 	}
 	for k, v := range config {
 		Log("Adding config key", k+"="+v)
@@ -193,77 +226,147 @@ func runCall(cmd *cobra.Command, call *callArgs) error {
 	}
 
 	// Memory
-	if call.memoryMaxPages > 0 {
+	if a.memoryMaxPages > 0 {
 		if manifest.Memory == nil {
 			manifest.Memory = &extism.ManifestMemory{}
 		}
-		Log("Max pages", call.memoryMaxPages)
-		manifest.Memory.MaxPages = uint32(call.memoryMaxPages)
+		Log("Max pages", a.memoryMaxPages)
+		manifest.Memory.MaxPages = uint32(a.memoryMaxPages)
 	}
 
-	if call.memoryHttpMaxBytes >= 0 {
+	if a.memoryHttpMaxBytes >= 0 {
 		if manifest.Memory == nil {
 			manifest.Memory = &extism.ManifestMemory{}
 		}
-		Log("HTTP response max bytes", call.memoryHttpMaxBytes)
-		manifest.Memory.MaxHttpResponseBytes = int64(call.memoryHttpMaxBytes)
+		Log("HTTP response max bytes", a.memoryHttpMaxBytes)
+		manifest.Memory.MaxHttpResponseBytes = int64(a.memoryHttpMaxBytes)
 	}
 
-	if call.memoryVarMaxBytes >= 0 {
+	if a.memoryVarMaxBytes >= 0 {
 		if manifest.Memory == nil {
 			manifest.Memory = &extism.ManifestMemory{}
 		}
-		Log("Var store size", call.memoryVarMaxBytes)
-		manifest.Memory.MaxVarBytes = int64(call.memoryVarMaxBytes)
+		Log("Var store size", a.memoryVarMaxBytes)
+		manifest.Memory.MaxVarBytes = int64(a.memoryVarMaxBytes)
 	}
 
-	var logLevel extism.LogLevel = extism.LogLevelError
-	switch call.logLevel {
+	if a.timeout > 0 {
+		Log("Setting timeout", a.timeout)
+		manifest.Timeout = a.timeout
+	}
+
+	return manifest, nil
+}
+
+func parseLogLevel(level string) extism.LogLevel {
+	switch level {
 	case "trace":
-		logLevel = extism.LogLevelTrace
+		return extism.LogLevelTrace
 	case "debug":
-		logLevel = extism.LogLevelDebug
+		return extism.LogLevelDebug
 	case "info":
-		logLevel = extism.LogLevelInfo
+		return extism.LogLevelInfo
 	case "warn":
-		logLevel = extism.LogLevelWarn
-	case "error":
-		logLevel = extism.LogLevelError
+		return extism.LogLevelWarn
+	default:
+		return extism.LogLevelError
 	}
+}
 
-	extism.SetLogLevel(logLevel)
+func (a *callArgs) getPluginConfig() (extism.PluginConfig, error) {
+	moduleConfig, err := a.getModuleConfig()
+	if err != nil {
+		return extism.PluginConfig{}, err
+	}
+	return extism.PluginConfig{
+		ModuleConfig:              moduleConfig,
+		RuntimeConfig:             wazero.NewRuntimeConfig().WithCloseOnContextDone(a.timeout > 0),
+		EnableWasi:                a.wasi,
+		EnableHttpResponseHeaders: a.enableHttpRespHeaders,
+	}, nil
+}
 
-	pluginConfig := extism.PluginConfig{
-		ModuleConfig:              wazero.NewModuleConfig().WithSysWalltime(),
-		RuntimeConfig:             wazero.NewRuntimeConfig().WithCloseOnContextDone(call.timeout > 0),
-		EnableWasi:                call.wasi,
-		EnableHttpResponseHeaders: call.enableHttpRespHeaders,
+func (a *callArgs) newPlugin(ctx context.Context, manifest extism.Manifest) (*extism.Plugin, error) {
+	pluginConfig, err := a.getPluginConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	if call.timeout > 0 {
-		Log("Setting timeout", call.timeout)
-		manifest.Timeout = call.timeout
+	// WASI output is configured using the module config, the go-sdk will
+	// override it with stdout/stderr when EXTISM_ENABLE_WASI_OUTPUT is set
+	if _, ok := os.LookupEnv("EXTISM_ENABLE_WASI_OUTPUT"); ok && (a.wasiStdout != "" || a.wasiStderr != "") {
+		Log("Unsetting EXTISM_ENABLE_WASI_OUTPUT")
+		os.Unsetenv("EXTISM_ENABLE_WASI_OUTPUT")
 	}
 
-	if globalPlugin == nil {
-		if pluginConfig.EnableWasi {
-			_, wasiOutput := os.LookupEnv("EXTISM_ENABLE_WASI_OUTPUT")
-			if ! wasiOutput {
-			    Log("Setting EXTISM_ENABLE_WASI_OUTPUT")
-			    os.Setenv("EXTISM_ENABLE_WASI_OUTPUT", "1")
-			}
+	resolved, err := resolveWasm(ctx, manifest.Wasm, a.offline, a.refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.requireSignature {
+		resolved, err = a.verifyModules(ctx, manifest.Wasm, resolved)
+		if err != nil {
+			return nil, err
 		}
+	}
+	manifest.Wasm = resolved
+
+	Log("Creating plugin")
+	return extism.NewPlugin(ctx, manifest, pluginConfig, []extism.HostFunction{})
+}
 
-		Log("Creating plugin")
-		globalPlugin, err = extism.NewPlugin(ctx, manifest, pluginConfig, []extism.HostFunction{})
+func runCall(cmd *cobra.Command, call *callArgs) error {
+	if len(call.args) < 1 {
+		return errors.New("a function name is required")
+	} else if len(call.args) < 2 && len(call.manifests) == 0 {
+		return errors.New("an input file or manifest is required")
+	}
+
+	ctx := context.Background()
+	wasm := ""
+	if len(call.args) > 1 {
+		wasm = call.args[0]
+	}
+	funcName := call.args[len(call.args)-1]
+
+	manifest, err := call.getManifest(wasm)
+	if err != nil {
+		return err
+	}
+
+	extism.SetLogLevel(parseLogLevel(call.logLevel))
+
+	defer call.closeFiles()
+
+	key := call.pluginKey(manifest)
+	if globalPlugin == nil || key != globalPluginKey {
+		if globalPlugin != nil {
+			globalPlugin.Close()
+			globalPlugin = nil
+		}
+		globalPlugin, err = call.newPlugin(ctx, manifest)
 		if err != nil {
 			return err
 		}
+		globalPluginKey = key
+		// The WASI stdio files are closed after the call, so the plugin can't
+		// be reused
+		if len(call.files) > 0 {
+			globalPluginKey = ""
+		}
 		//defer plugin.Close()
 	} else {
 		Log("Reusing Plugin")
 	}
 
+	logger, err := newPluginLogger(call.logFormat, call.logFile)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+	globalPlugin.SetLogger(logger.log)
+
 	input := []byte(call.input)
 	if call.stdin {
 		Log("Reading input from stdin")
@@ -271,24 +374,35 @@ func runCall(cmd *cobra.Command, call *callArgs) error {
 	}
 	Log("Got", len(input), "bytes of input data")
 
+	then, err := call.getThenStages()
+	if err != nil {
+		return err
+	}
+	stages, err := newPipeline(ctx, call, then, logger, 1)
+	if err != nil {
+		return err
+	}
+	defer closePipeline(stages)
+	first := pipelineInstance{name: stageName(wasm, funcName), function: funcName, plugin: globalPlugin}
+	if call.schema != "" {
+		first.schema, err = loadSchema(call.schema)
+		if err != nil {
+			return err
+		}
+	}
+	stages = append([]pipelineInstance{first}, stages...)
+
 	// Call the plugin in a loop
 	for i := 0; i < call.loop; i++ {
-		Log("Calling", funcName)
-		exit, res, err := globalPlugin.CallWithContext(ctx, funcName, input)
+		logger.call = i
+		res, err := runPipeline(ctx, stages, input)
 		if err != nil {
-			if exit == sys.ExitCodeDeadlineExceeded {
-				return errors.New("timeout")
-			} else if exit != 0 {
-				return errors.Join(err, fmt.Errorf("returned non-zero exit code: %d", exit))
-			}
-
 			return err
 		}
-		Log("Call returned", len(res), "bytes")
-		fmt.Println(string(res))
+		fmt.Fprintln(cmd.OutOrStdout(), string(res))
 
 		if call.loop > 1 {
-			fmt.Println()
+			fmt.Fprintln(cmd.OutOrStdout())
 		}
 
 	}
@@ -296,33 +410,79 @@ func runCall(cmd *cobra.Command, call *callArgs) error {
 	return nil
 }
 
+// callFunction calls a plugin function and converts non-zero exit codes into
+// errors
+func callFunction(ctx context.Context, plugin *extism.Plugin, funcName string, input []byte) ([]byte, error) {
+	Log("Calling", funcName)
+	exit, res, err := plugin.CallWithContext(ctx, funcName, input)
+	if err != nil {
+		if exit == sys.ExitCodeDeadlineExceeded {
+			return nil, errors.New("timeout")
+		} else if exit != 0 {
+			return nil, errors.Join(err, fmt.Errorf("returned non-zero exit code: %d", exit))
+		}
+
+		return nil, err
+	}
+	Log("Call returned", len(res), "bytes")
+	return res, nil
+}
+
 func CallCmd() *cobra.Command {
 	call := &callArgs{}
 	cmd :=
 		&cobra.Command{
-			Use:          "call [flags] wasm_file function",
+			Use:          "call [flags] [wasm_file] function",
 			Short:        "Call a plugin function",
 			SilenceUsage: true,
 			RunE:         RunArgs(runCall, call),
-			Args:         cobra.ExactArgs(2),
+			Args:         cobra.RangeArgs(1, 2),
 		}
 	flags := cmd.Flags()
 	flags.StringVarP(&call.input, "input", "i", "", "Input data")
 	flags.BoolVar(&call.stdin, "stdin", false, "Read input from stdin")
 	flags.IntVar(&call.loop, "loop", 1, "Number of times to call the function")
+	flags.StringVar(&call.schema, "schema", "", "Validate the input and output of the function against an XTP schema")
+	flags.StringArrayVar(&call.then, "then", []string{}, "Pass the output to another plugin function, should be in WASM_FILE:FUNCTION format, may be repeated")
+	addPluginFlags(cmd, call)
+	cmd.MarkFlagsMutuallyExclusive("input", "stdin")
+	return cmd
+}
+
+// addManifestFlags registers the plugin options that are applied using the
+// manifest, they're supported by both the go-sdk and libextism
+func addManifestFlags(cmd *cobra.Command, call *callArgs) {
+	flags := cmd.Flags()
 	flags.BoolVar(&call.wasi, "wasi", false, "Enable WASI")
-	flags.StringArrayVar(&call.allowedPaths, "allow-path", []string{}, "Allow a path to be accessed from inside the Wasm sandbox, a path can be either a plain path or a map from HOST_PATH:GUEST_PATH")
+	flags.StringArrayVar(&call.allowedPaths, "allow-path", []string{}, "Allow a path to be accessed from inside the Wasm sandbox, a path can be either a plain path or a map from HOST_PATH:GUEST_PATH, prefix with ro: to mount read-only")
 	flags.StringArrayVar(&call.allowedHosts, "allow-host", []string{}, "Allow access to an HTTP host, if no hosts are listed then all requests will fail. Globs may be used for wildcards")
-	flags.BoolVar(&call.enableHttpRespHeaders, "enable-http-response-headers", false, "Enable HTTP response headers to be read by plugins for any request to an allowed host.")
 	flags.Uint64Var(&call.timeout, "timeout", 0, "Timeout in milliseconds")
 	flags.IntVar(&call.memoryMaxPages, "memory-max", 0, "Maximum number of pages to allocate")
 	flags.IntVar(&call.memoryHttpMaxBytes, "http-response-max", -1, "Maximum HTTP response size in bytes when using `extism_http_request`")
 	flags.IntVar(&call.memoryVarMaxBytes, "var-max", -1, "Maximum size in bytes of Extism var store")
 	flags.StringArrayVar(&call.config, "config", []string{}, "Set config values, should be in KEY=VALUE format")
 	flags.StringVar(&call.setConfig, "set-config", "", "Create config object using JSON, this will be merged with any `config` arguments")
-	flags.BoolVarP(&call.manifest, "manifest", "m", false, "When set the input file will be parsed as a JSON encoded Extism manifest instead of a WASM file")
-	flags.StringVar(&call.logLevel, "log-level", "", "Set log level: trace, debug, warn, info, error")
+	flags.BoolVarP(&call.manifest, "manifest", "m", false, "When set the input file will be parsed as a JSON, YAML or TOML encoded Extism manifest instead of a WASM file")
+	flags.StringArrayVar(&call.manifests, "manifest-file", []string{}, "Load a JSON, YAML or TOML encoded Extism manifest, may be repeated to merge multiple manifests, ${VAR} is replaced with environment variables in YAML and TOML manifests")
 	flags.StringArrayVar(&call.link, "link", []string{}, "Additional modules to link")
-	cmd.MarkFlagsMutuallyExclusive("input", "stdin")
-	return cmd
+}
+
+// addPluginFlags registers the flags used to configure a plugin instance, these
+// are shared by all commands that load a plugin using the go-sdk
+func addPluginFlags(cmd *cobra.Command, call *callArgs) {
+	addManifestFlags(cmd, call)
+	flags := cmd.Flags()
+	flags.StringArrayVar(&call.env, "env", []string{}, "Set WASI environment variables, should be in KEY=VALUE format")
+	flags.StringArrayVar(&call.wasiArgs, "wasi-arg", []string{}, "Add a WASI command-line argument, the first argument is the program name")
+	flags.StringVar(&call.wasiStdin, "wasi-stdin", "", "Read WASI stdin from a file")
+	flags.StringVar(&call.wasiStdout, "wasi-stdout", "", "Write WASI stdout to a file")
+	flags.StringVar(&call.wasiStderr, "wasi-stderr", "", "Write WASI stderr to a file")
+	flags.BoolVar(&call.enableHttpRespHeaders, "enable-http-response-headers", false, "Enable HTTP response headers to be read by plugins for any request to an allowed host.")
+	flags.StringVar(&call.logLevel, "log-level", "", "Set log level: trace, debug, warn, info, error")
+	flags.StringVar(&call.logFormat, "log-format", "text", "Format of plugin log messages: text, json")
+	flags.StringVar(&call.logFile, "log-file", "", "Write plugin log messages to a file instead of stderr")
+	flags.BoolVar(&call.offline, "offline", false, "Only use cached modules when loading Wasm from a URL, see `extism fetch`")
+	flags.BoolVar(&call.refresh, "refresh", false, "Download modules loaded from a URL again even if a recently fetched copy is cached")
+	flags.BoolVar(&call.requireSignature, "require-signature", false, "Refuse to load any module without a valid signature from a trusted key, see `extism sign`")
+	flags.StringArrayVar(&call.trustedKeys, "trusted-key", []string{}, "PEM encoded ed25519 public key trusted to sign modules, may be repeated")
 }
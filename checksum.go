@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// isChecksumAsset returns true for release assets that contain checksums for
+// name: either a file for that asset, e.g. `<name>.sha256`, or a file with
+// checksums for all assets, e.g. `SHA256SUMS`
+func isChecksumAsset(asset, name string) bool {
+	lower := strings.ToLower(asset)
+	if !strings.Contains(lower, "sha256") && !strings.Contains(lower, "checksum") {
+		return false
+	}
+	base := strings.TrimSuffix(name, ".tar.gz")
+	return strings.HasPrefix(asset, base) || !strings.HasPrefix(asset, "libextism-")
+}
+
+// parseChecksum finds the sha256 of name in a checksum file using the
+// `sha256sum` format, a file with a single hash and no name is also accepted
+func parseChecksum(data []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !isSha256(fields[0]) {
+			continue
+		}
+		if len(fields) == 1 || path.Base(strings.TrimPrefix(fields[1], "*")) == name {
+			return strings.ToLower(fields[0])
+		}
+	}
+	return ""
+}
+
+func isSha256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+func fetchChecksumFile(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch %s: %s", url, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// releaseChecksum returns the published sha256 of a release asset, or an
+// empty string if the release doesn't include a checksum for it
+func releaseChecksum(ctx context.Context, rel *github.RepositoryRelease, name string) (string, error) {
+	for _, asset := range rel.Assets {
+		if !isChecksumAsset(asset.GetName(), name) {
+			continue
+		}
+		Log("Fetching checksums from", asset.GetBrowserDownloadURL())
+		data, err := fetchChecksumFile(ctx, asset.GetBrowserDownloadURL())
+		if err != nil {
+			return "", err
+		}
+		if sum := parseChecksum(data, name); sum != "" {
+			return sum, nil
+		}
+	}
+	return "", nil
+}
+
+// mirrorChecksumNames lists the checksum files looked for on a mirror, a
+// mirror can't list its files so the names used by releases are tried in order
+func mirrorChecksumNames(name string) []string {
+	base := strings.TrimSuffix(name, ".tar.gz")
+	candidates := []string{
+		name + ".sha256",
+		name + ".sha256sum",
+		name + ".checksum.txt",
+		base + ".sha256",
+		base + ".checksum.txt",
+		"SHA256SUMS",
+		"SHA256SUMS.txt",
+		"sha256sums.txt",
+		"checksums.txt",
+	}
+	names := []string{}
+	for _, c := range candidates {
+		if isChecksumAsset(c, name) {
+			names = append(names, c)
+		}
+	}
+	return names
+}
+
+// mirrorChecksum returns the sha256 of an asset on a mirror from a checksum
+// file next to it, or an empty string if the mirror doesn't have one
+func mirrorChecksum(ctx context.Context, url, name string) (string, error) {
+	dir := url[:strings.LastIndex(url, "/")+1]
+	for _, file := range mirrorChecksumNames(name) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, dir+file, nil)
+		if err != nil {
+			return "", err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		// Some object stores return 403 for missing files
+		if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusForbidden {
+			res.Body.Close()
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return "", fmt.Errorf("unable to fetch %s: %s", dir+file, res.Status)
+		}
+		data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+		res.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		Log("Fetched checksums from", dir+file)
+		if sum := parseChecksum(data, name); sum != "" {
+			return sum, nil
+		}
+	}
+	return "", nil
+}
+
+// errNoChecksum is returned by verifyChecksum when a checksum is required but
+// none was found
+var errNoChecksum = errors.New("no checksum available")
+
+// verifyChecksum checks data against the expected sha256, when there is no
+// expected checksum verification is skipped unless it's required
+func verifyChecksum(name string, data []byte, expected string, required bool) error {
+	if expected == "" {
+		if required {
+			return fmt.Errorf("%w for %s", errNoChecksum, name)
+		}
+		Print("Warning: no checksum available for", name+", skipping verification")
+		return nil
+	}
+
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if !isSha256(expected) {
+		return fmt.Errorf("invalid sha256 checksum: %s", expected)
+	}
+
+	actual := sha256Hex(data)
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, expected, actual)
+	}
+	Log("Verified checksum for", name, actual)
+	return nil
+}
@@ -0,0 +1,357 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/spf13/cobra"
+)
+
+type conformanceArgs struct {
+	callArgs
+	lib    string
+	cases  string
+	inputs []string
+	json   bool
+}
+
+// conformanceCase is a single function call, cases are read from a JSON, YAML
+// or TOML file with a top-level `cases` list
+type conformanceCase struct {
+	Name     string            `json:"name"`
+	Wasm     string            `json:"wasm"`
+	Manifest []string          `json:"manifest"`
+	Function string            `json:"function"`
+	Input    string            `json:"input"`
+	Config   map[string]string `json:"config"`
+	Wasi     bool              `json:"wasi"`
+}
+
+// runtimeResult is the outcome of a call using one runtime
+type runtimeResult struct {
+	Failed   bool          `json:"failed"`
+	Output   string        `json:"output"`
+	Error    string        `json:"error,omitempty"`
+	ExitCode int32         `json:"exit_code"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type conformanceResult struct {
+	Case        string   `json:"case"`
+	Function    string   `json:"function"`
+	Match       bool     `json:"match"`
+	Differences []string `json:"differences"`
+	// Notes lists error messages and exit codes that differ, these are
+	// reported but don't count as differences
+	Notes     []string      `json:"notes,omitempty"`
+	GoSdk     runtimeResult `json:"go_sdk"`
+	LibExtism runtimeResult `json:"libextism"`
+}
+
+func loadConformanceCases(path string) ([]conformanceCase, error) {
+	m, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Cases []conformanceCase `json:"cases"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid conformance cases %s: %w", path, err)
+	}
+	if len(file.Cases) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", path)
+	}
+	for i, c := range file.Cases {
+		if c.Function == "" {
+			return nil, fmt.Errorf("case %d in %s has no function", i+1, path)
+		}
+		if c.Wasm == "" && len(c.Manifest) == 0 {
+			return nil, fmt.Errorf("case %d in %s has no wasm file or manifest", i+1, path)
+		}
+	}
+	return file.Cases, nil
+}
+
+// getCases returns the cases from the cases file, or one case for each input
+// when a wasm file and function are passed as arguments
+func (a *conformanceArgs) getCases() ([]conformanceCase, error) {
+	if a.cases != "" {
+		if len(a.args) > 0 {
+			return nil, errors.New("a wasm file and function can't be used with --cases")
+		}
+		return loadConformanceCases(a.cases)
+	}
+
+	if len(a.args) < 1 {
+		return nil, errors.New("a function name or --cases file is required")
+	} else if len(a.args) < 2 && len(a.manifests) == 0 {
+		return nil, errors.New("an input file or manifest is required")
+	}
+	wasm := ""
+	if len(a.args) > 1 {
+		wasm = a.args[0]
+	}
+	funcName := a.args[len(a.args)-1]
+
+	inputs := a.inputs
+	if len(inputs) == 0 {
+		inputs = []string{""}
+	}
+	cases := []conformanceCase{}
+	for i, input := range inputs {
+		name := funcName
+		if len(inputs) > 1 {
+			name = fmt.Sprintf("%s #%d", funcName, i+1)
+		}
+		cases = append(cases, conformanceCase{Name: name, Wasm: wasm, Function: funcName, Input: input})
+	}
+	return cases, nil
+}
+
+// caseArgs applies the options from a case to a copy of the command-line
+// arguments
+func (a *conformanceArgs) caseArgs(c conformanceCase) *callArgs {
+	call := a.callArgs
+	call.wasi = call.wasi || c.Wasi
+	if len(c.Manifest) > 0 {
+		call.manifests = append(append([]string{}, call.manifests...), c.Manifest...)
+	}
+	call.config = append([]string{}, call.config...)
+	for k, v := range c.Config {
+		call.config = append(call.config, k+"="+v)
+	}
+	return &call
+}
+
+func runGoSdkCase(ctx context.Context, call *callArgs, manifest extism.Manifest, c conformanceCase) runtimeResult {
+	plugin, err := call.newPlugin(ctx, manifest)
+	if err != nil {
+		return runtimeResult{Failed: true, Error: err.Error()}
+	}
+	defer plugin.Close()
+
+	start := time.Now()
+	exit, output, err := plugin.CallWithContext(ctx, c.Function, []byte(c.Input))
+	result := runtimeResult{Output: string(output), ExitCode: int32(exit), Duration: time.Since(start)}
+	if err != nil || exit != 0 {
+		result.Failed = true
+		result.Output = ""
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func runLibExtismCase(lib *libExtism, call *callArgs, manifest extism.Manifest, c conformanceCase) runtimeResult {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return runtimeResult{Failed: true, Error: err.Error()}
+	}
+	plugin, err := lib.newPlugin(data, call.wasi)
+	if err != nil {
+		return runtimeResult{Failed: true, Error: err.Error()}
+	}
+	defer plugin.close()
+
+	start := time.Now()
+	output, rc, err := plugin.call(c.Function, []byte(c.Input))
+	result := runtimeResult{Output: string(output), ExitCode: rc, Duration: time.Since(start)}
+	if err != nil {
+		result.Failed = true
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// compareResults lists the differences between the two runtimes. Error
+// messages and exit codes are specific to each runtime, so only whether the
+// call failed is compared and outputs are compared when both calls succeeded.
+// Timing is reported but never counted as a difference.
+func compareResults(goSdk, libExtism runtimeResult) []string {
+	diffs := []string{}
+	if goSdk.Failed != libExtism.Failed {
+		diffs = append(diffs, "result")
+	} else if !goSdk.Failed && goSdk.Output != libExtism.Output {
+		diffs = append(diffs, "output")
+	}
+	return diffs
+}
+
+// compareDetails lists the error messages and exit codes that differ between
+// the two runtimes when both calls failed
+func compareDetails(goSdk, libExtism runtimeResult) []string {
+	notes := []string{}
+	if !goSdk.Failed || !libExtism.Failed {
+		return notes
+	}
+	if goSdk.Error != libExtism.Error {
+		notes = append(notes, "error")
+	}
+	if goSdk.ExitCode != libExtism.ExitCode {
+		notes = append(notes, "exit code")
+	}
+	return notes
+}
+
+// describeResult summarizes whether a call succeeded for the report
+func describeResult(r runtimeResult) string {
+	if !r.Failed {
+		return "ok"
+	}
+	return fmt.Sprintf("failed with exit code %d: %s", r.ExitCode, r.Error)
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+func writeConformanceReport(w io.Writer, results []conformanceResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tRESULT\tGO-SDK\tLIBEXTISM")
+	for _, r := range results {
+		status := "ok"
+		if !r.Match {
+			status = "DIFF"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Case, status, formatDuration(r.GoSdk.Duration), formatDuration(r.LibExtism.Duration))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Match && len(r.Notes) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", r.Case)
+		for _, d := range r.Differences {
+			writeDifference(w, r, d, d)
+		}
+		for _, n := range r.Notes {
+			writeDifference(w, r, n, n+" (informational)")
+		}
+	}
+	return nil
+}
+
+func writeDifference(w io.Writer, r conformanceResult, field, label string) {
+	var a, b string
+	switch field {
+	case "output":
+		a, b = r.GoSdk.Output, r.LibExtism.Output
+	case "result":
+		a, b = describeResult(r.GoSdk), describeResult(r.LibExtism)
+	case "error":
+		a, b = r.GoSdk.Error, r.LibExtism.Error
+	case "exit code":
+		a, b = fmt.Sprint(r.GoSdk.ExitCode), fmt.Sprint(r.LibExtism.ExitCode)
+	}
+	fmt.Fprintf(w, "  %s:\n", label)
+	fmt.Fprintf(w, "  - go-sdk:    %q\n", a)
+	fmt.Fprintf(w, "  + libextism: %q\n", b)
+}
+
+func runConformance(cmd *cobra.Command, conformance *conformanceArgs) error {
+	cases, err := conformance.getCases()
+	if err != nil {
+		return err
+	}
+
+	lib, err := loadLibExtism(conformance.lib)
+	if err != nil {
+		return err
+	}
+	Log("Using libextism", lib.version())
+
+	ctx := context.Background()
+	results := []conformanceResult{}
+	failed := 0
+	for _, c := range cases {
+		name := c.Name
+		if name == "" {
+			name = c.Function
+		}
+		Log("Running case", name)
+
+		call := conformance.caseArgs(c)
+		manifest, err := call.getManifest(c.Wasm)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		result := conformanceResult{Case: name, Function: c.Function}
+		result.GoSdk = runGoSdkCase(ctx, call, manifest, c)
+		result.LibExtism = runLibExtismCase(lib, call, manifest, c)
+		result.Differences = compareResults(result.GoSdk, result.LibExtism)
+		result.Notes = compareDetails(result.GoSdk, result.LibExtism)
+		result.Match = len(result.Differences) == 0
+		if !result.Match {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	out := cmd.OutOrStdout()
+	if conformance.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := writeConformanceReport(out, results); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases differ between go-sdk and libextism %s", failed, len(results), lib.version())
+	}
+	return nil
+}
+
+func ConformanceCmd() *cobra.Command {
+	conformance := &conformanceArgs{}
+	cmd := &cobra.Command{
+		Use:   "conformance [flags] [wasm_file] [function]",
+		Short: "Compare plugin results between the go-sdk and libextism",
+		Long: strings.Join([]string{
+			"Run the same plugin calls using the runtime built into the CLI (go-sdk) and the installed libextism, then report any differences along with the time taken by each runtime. Only whether a call failed is compared since error messages and exit codes differ between runtimes, outputs are compared when both calls succeed. When both calls fail, differing error messages and exit codes are shown but don't count as differences.",
+			"",
+			"Cases can be passed on the command line, one for each --input, or read from a JSON, YAML or TOML file using --cases:",
+			"",
+			"  cases:",
+			"    - name: vowels",
+			"      wasm: plugin.wasm",
+			"      function: count_vowels",
+			"      input: hello",
+			"      config: {vowels: aeiouy}",
+		}, "\n"),
+		Example:      "conformance plugin.wasm count_vowels --input hello --input world\nconformance --cases cases.yaml --lib ~/.local/lib/libextism.so",
+		SilenceUsage: true,
+		RunE:         RunArgs(runConformance, conformance),
+		Args:         cobra.MaximumNArgs(2),
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&conformance.lib, "lib", sharedLibraryName(runtime.GOOS), "Path to the libextism shared object, by default it's found using the dynamic loader search path")
+	flags.StringVar(&conformance.cases, "cases", "", "Read cases from a JSON, YAML or TOML file")
+	flags.StringArrayVarP(&conformance.inputs, "input", "i", []string{}, "Input data, may be repeated to run a case for each input")
+	flags.BoolVar(&conformance.json, "json", false, "Print the report as JSON")
+	addManifestFlags(cmd, &conformance.callArgs)
+	return cmd
+}
@@ -2,8 +2,45 @@
 
 package cli
 
-import "github.com/ebitengine/purego"
+import (
+	"errors"
+
+	"github.com/ebitengine/purego"
+)
 
 func dlopen(name string) (uintptr, error) {
 	return purego.Dlopen(name, purego.RTLD_GLOBAL|purego.RTLD_NOW)
 }
+
+func dlsym(handle uintptr, name string) (uintptr, error) {
+	return purego.Dlsym(handle, name)
+}
+
+// dlInfo matches `Dl_info` from dlfcn.h
+type dlInfo struct {
+	fname *byte
+	fbase uintptr
+	sname *byte
+	saddr uintptr
+}
+
+// dlpath returns the file a library was loaded from, using `dladdr` on one of
+// its symbols
+func dlpath(handle uintptr, symbol string) (string, error) {
+	addr, err := purego.Dlsym(handle, symbol)
+	if err != nil {
+		return "", err
+	}
+	fn, err := purego.Dlsym(purego.RTLD_DEFAULT, "dladdr")
+	if err != nil {
+		return "", err
+	}
+	var dladdr func(addr uintptr, info *dlInfo) int32
+	purego.RegisterFunc(&dladdr, fn)
+
+	var info dlInfo
+	if dladdr(addr, &info) == 0 || info.fname == nil {
+		return "", errors.New("unable to find the path of " + symbol)
+	}
+	return cString(info.fname), nil
+}
@@ -6,3 +6,17 @@ func dlopen(name string) (uintptr, error) {
 	handle, err := windows.LoadLibrary(name)
 	return uintptr(handle), err
 }
+
+func dlsym(handle uintptr, name string) (uintptr, error) {
+	return windows.GetProcAddress(windows.Handle(handle), name)
+}
+
+// dlpath returns the file a library was loaded from
+func dlpath(handle uintptr, symbol string) (string, error) {
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetModuleFileName(windows.Handle(handle), &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:n]), nil
+}
@@ -0,0 +1,348 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/ebitengine/purego"
+	"github.com/spf13/cobra"
+)
+
+// doctor collects the results of each check, problems make the command fail
+type doctor struct {
+	w        io.Writer
+	problems int
+	warnings int
+}
+
+func (d *doctor) ok(msg ...any) {
+	fmt.Fprintln(d.w, "[ok]  ", fmt.Sprint(msg...))
+}
+
+func (d *doctor) warn(fix string, msg ...any) {
+	d.warnings++
+	fmt.Fprintln(d.w, "[warn]", fmt.Sprint(msg...))
+	if fix != "" {
+		fmt.Fprintln(d.w, "       fix:", fix)
+	}
+}
+
+func (d *doctor) fail(fix string, msg ...any) {
+	d.problems++
+	fmt.Fprintln(d.w, "[fail]", fmt.Sprint(msg...))
+	if fix != "" {
+		fmt.Fprintln(d.w, "       fix:", fix)
+	}
+}
+
+var headerVersionPattern = regexp.MustCompile(`#define\s+EXTISM_VERSION\s+"([^"]+)"`)
+
+// loaderPathVar is the environment variable used by the dynamic loader to find
+// shared libraries
+func loaderPathVar(osName string) string {
+	switch osName {
+	case "darwin":
+		return "DYLD_LIBRARY_PATH"
+	case "windows":
+		return "PATH"
+	default:
+		return "LD_LIBRARY_PATH"
+	}
+}
+
+func systemLibDirs(osName string) []string {
+	switch osName {
+	case "darwin":
+		return []string{"/usr/local/lib", "/opt/homebrew/lib", "/usr/lib"}
+	case "windows":
+		return []string{}
+	default:
+		return []string{"/usr/local/lib", "/usr/lib", "/usr/lib64", "/lib", "/lib64", "/usr/lib/" + linuxMultiarch() + "-linux-gnu"}
+	}
+}
+
+func linuxMultiarch() string {
+	if runtime.GOARCH == "arm64" {
+		return "aarch64"
+	}
+	return "x86_64"
+}
+
+func splitPathList(s string) []string {
+	dirs := []string{}
+	for _, dir := range filepath.SplitList(s) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// ldconfigPaths lists the paths of a library known to the ldconfig cache
+func ldconfigPaths(soName string) []string {
+	out, err := exec.Command("ldconfig", "-p").Output()
+	if err != nil {
+		return nil
+	}
+	paths := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, soName+" ") {
+			continue
+		}
+		if _, path, ok := strings.Cut(line, "=> "); ok {
+			paths = append(paths, strings.TrimSpace(path))
+		}
+	}
+	return paths
+}
+
+// findLibraries returns every copy of the shared library in the install prefix
+// and the directories searched by the dynamic loader
+func findLibraries(a *libArgs, soName string) []string {
+	dirs := []string{filepath.Join(a.prefix, a.libDir)}
+	dirs = append(dirs, splitPathList(os.Getenv(loaderPathVar(runtime.GOOS)))...)
+	dirs = append(dirs, systemLibDirs(runtime.GOOS)...)
+
+	seen := map[string]bool{}
+	found := []string{}
+	add := func(path string) {
+		abs, err := filepath.Abs(path)
+		if err != nil || seen[abs] {
+			return
+		}
+		seen[abs] = true
+		if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+			found = append(found, abs)
+		}
+	}
+	for _, dir := range dirs {
+		add(filepath.Join(dir, soName))
+	}
+	if runtime.GOOS == "linux" {
+		for _, path := range ldconfigPaths(soName) {
+			add(path)
+		}
+	}
+	return found
+}
+
+// loadedLibrary loads a shared library, name may be a path or a file name
+// that's found using the dynamic loader search path. The path of the file
+// that was loaded is returned with the result of its `extism_version`.
+func loadedLibrary(name string) (string, string, error) {
+	ptr, err := dlopen(name)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := dlsym(ptr, "extism_version"); err != nil {
+		return "", "", err
+	}
+	path, err := dlpath(ptr, "extism_version")
+	if err != nil {
+		Log("Unable to find the path of", name+":", err)
+		path = name
+	}
+	var version func() string
+	purego.RegisterLibFunc(&version, ptr, "extism_version")
+	return path, version(), nil
+}
+
+// headerVersion returns the version of an installed header, using
+// `EXTISM_VERSION` when it's defined or the versioned directory it links to
+func headerVersion(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if m := headerVersionPattern.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		dir := filepath.Dir(target)
+		if filepath.Base(filepath.Dir(dir)) == "extism" {
+			return filepath.Base(dir)
+		}
+	}
+	return ""
+}
+
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// readPkgConfig parses the variables and fields of a pkg-config file, variable
+// references are expanded
+func readPkgConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	expand := func(s string) string {
+		return os.Expand(s, func(k string) string { return values[k] })
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexAny(line, "=:"); i > 0 {
+			key := strings.TrimSpace(line[:i])
+			values[key] = expand(strings.TrimSpace(line[i+1:]))
+		}
+	}
+	return values, nil
+}
+
+// pkgConfigSearchPath returns the directories searched by pkg-config
+func pkgConfigSearchPath() ([]string, bool) {
+	dirs := splitPathList(os.Getenv("PKG_CONFIG_PATH"))
+	out, err := exec.Command("pkg-config", "--variable", "pc_path", "pkg-config").Output()
+	if err != nil {
+		return dirs, false
+	}
+	return append(dirs, splitPathList(strings.TrimSpace(string(out)))...), true
+}
+
+func containsPath(dirs []string, dir string) bool {
+	abs, _ := filepath.Abs(dir)
+	for _, d := range dirs {
+		if a, _ := filepath.Abs(d); a == abs {
+			return true
+		}
+	}
+	return false
+}
+
+func runLibDoctor(cmd *cobra.Command, doctorArgs *libArgs) error {
+	d := &doctor{w: cmd.OutOrStdout()}
+	soName := sharedLibraryName(runtime.GOOS)
+	libDir := filepath.Join(doctorArgs.prefix, doctorArgs.libDir)
+	includeDir := filepath.Join(doctorArgs.prefix, doctorArgs.includeDir)
+	installCmd := "extism lib install --prefix " + doctorArgs.prefix
+
+	// The library found by the dynamic loader is loaded first, a library that
+	// is already loaded would be reused otherwise
+	Log("dlopen", soName)
+	loaded, loadedVersion, loaderErr := loadedLibrary(soName)
+
+	// Shared object
+	soPath := filepath.Join(libDir, soName)
+	soVersion := ""
+	if _, err := os.Stat(soPath); err != nil {
+		d.fail(installCmd, soName, " not found in ", libDir)
+	} else if _, v, err := loadedLibrary(soPath); err != nil {
+		d.fail(installCmd, "unable to load ", soPath, ": ", err)
+	} else {
+		soVersion = v
+		d.ok("found ", soPath, " (version ", v, ")")
+	}
+
+	if current := currentLibVersion(doctorArgs); current != "" {
+		d.ok("active version is ", current)
+		if soVersion != "" && !sameVersion(current, soVersion) && current != "latest" {
+			d.warn("extism lib use "+current+" --prefix "+doctorArgs.prefix, "active version ", current, " doesn't match the shared object version ", soVersion)
+		}
+	}
+
+	// Header
+	headerPath := filepath.Join(includeDir, "extism.h")
+	if _, err := os.Stat(headerPath); err != nil {
+		d.fail(installCmd, "extism.h not found in ", includeDir)
+	} else if v := headerVersion(headerPath); v == "" {
+		d.warn("", "unable to determine the version of ", headerPath)
+	} else if soVersion != "" && !sameVersion(v, soVersion) && v != "latest" {
+		d.fail("extism lib use "+v+" --prefix "+doctorArgs.prefix+", or reinstall libextism", "header version ", v, " doesn't match the shared object version ", soVersion)
+	} else {
+		d.ok("found ", headerPath, " (version ", v, ")")
+	}
+
+	// pkg-config
+	if runtime.GOOS != "windows" {
+		pkgconfigDir := filepath.Join(libDir, "pkgconfig")
+		pcPath := filepath.Join(pkgconfigDir, "extism.pc")
+		pc, err := readPkgConfig(pcPath)
+		if err != nil {
+			d.fail(installCmd, "extism.pc not found in ", pkgconfigDir)
+		} else {
+			absPrefix, _ := filepath.Abs(doctorArgs.prefix)
+			pcPrefix, _ := filepath.Abs(pc["prefix"])
+			if pcPrefix != absPrefix {
+				d.fail(installCmd, pcPath, " has prefix ", pc["prefix"], " but is installed in ", doctorArgs.prefix)
+			} else {
+				d.ok(pcPath, " prefix is ", pc["prefix"])
+			}
+
+			if libs := pc["Libs"]; !strings.Contains(libs, "-lextism") {
+				d.fail(installCmd, pcPath, " Libs doesn't link libextism: ", libs)
+			} else if l := pc["libdir"]; l != "" {
+				if _, err := os.Stat(filepath.Join(l, soName)); err != nil {
+					d.fail(installCmd, pcPath, " libdir ", l, " doesn't contain ", soName)
+				}
+			}
+			if i := pc["includedir"]; i != "" {
+				if _, err := os.Stat(filepath.Join(i, "extism.h")); err != nil {
+					d.fail(installCmd, pcPath, " includedir ", i, " doesn't contain extism.h")
+				}
+			}
+		}
+
+		searchPath, found := pkgConfigSearchPath()
+		if !found {
+			d.warn("install pkg-config", "pkg-config not found")
+		} else if !containsPath(searchPath, pkgconfigDir) {
+			d.warn("export PKG_CONFIG_PATH="+pkgconfigDir+string(os.PathListSeparator)+"$PKG_CONFIG_PATH", pkgconfigDir, " isn't in the pkg-config search path")
+		} else {
+			d.ok(pkgconfigDir, " is in the pkg-config search path")
+		}
+	}
+
+	// Dynamic loader, the library it finds may not be the one in the prefix
+	pathVar := loaderPathVar(runtime.GOOS)
+	fix := "export " + pathVar + "=" + libDir + string(os.PathListSeparator) + "$" + pathVar
+	if runtime.GOOS == "linux" {
+		fix += ", or add " + libDir + " to /etc/ld.so.conf.d and run `ldconfig`"
+	}
+	if loaderErr != nil {
+		d.warn(fix, soName, " can't be loaded by the dynamic loader: ", loaderErr)
+	} else if soVersion != "" && !sameVersion(loadedVersion, soVersion) {
+		d.warn(fix, "the dynamic loader resolves ", soName, " to ", loaded, " (version ", loadedVersion, ") instead of version ", soVersion, " in ", libDir)
+	} else {
+		d.ok("the dynamic loader resolves ", soName, " to ", loaded, " (version ", loadedVersion, ")")
+	}
+
+	// Conflicting installations
+	libs := findLibraries(doctorArgs, soName)
+	hashes := map[string][]string{}
+	for _, lib := range libs {
+		data, err := os.ReadFile(lib)
+		if err != nil {
+			continue
+		}
+		hash := sha256Hex(data)
+		hashes[hash] = append(hashes[hash], lib)
+	}
+	if len(hashes) > 1 {
+		d.warn("remove the installations that aren't needed using `extism lib uninstall --prefix <prefix>`", "found ", len(hashes), " different copies of ", soName, ": ", strings.Join(libs, ", "))
+	} else if len(libs) > 0 {
+		d.ok("no conflicting installations found")
+	}
+
+	fmt.Fprintf(d.w, "\n%d problem(s), %d warning(s)\n", d.problems, d.warnings)
+	if d.problems > 0 {
+		return errors.New("libextism installation has problems")
+	}
+	return nil
+}
@@ -23,9 +23,10 @@ var banner string = `
 var version string
 
 func rootCmd() *cobra.Command {
+	cli.Version = strings.TrimSpace(version)
 	cmd := &cobra.Command{
 		Use:     "extism",
-		Version: strings.TrimSpace(version),
+		Version: cli.Version,
 		Long:    banner,
 		Short:   "A CLI for Extism, https://extism.org",
 	}
@@ -36,6 +37,14 @@ func rootCmd() *cobra.Command {
 	cmd.AddCommand(cli.CallCmd())
 	cmd.AddCommand(cli.LibCmd())
 	cmd.AddCommand(cli.GenerateCmd())
+	cmd.AddCommand(cli.ReplCmd())
+	cmd.AddCommand(cli.FetchCmd())
+	cmd.AddCommand(cli.SignCmd())
+	cmd.AddCommand(cli.VerifyCmd())
+	cmd.AddCommand(cli.PipeCmd())
+	cmd.AddCommand(cli.ConformanceCmd())
+	cmd.AddCommand(cli.SelfUpdateCmd())
+	cmd.AddCommand(cli.VersionCmd())
 	cmd.AddCommand(shell.New(cmd, nil))
 	return cmd
 }
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLibVersions(t *testing.T) {
@@ -16,6 +28,753 @@ func TestLibVersions(t *testing.T) {
 	}
 }
 
+// libTarball creates a release tarball containing the given files
+func libTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var libTarballFiles = map[string]string{
+	"libextism.so": "shared",
+	"libextism.a":  "static",
+	"extism.h":     "header",
+	"extism.pc.in": "prefix=/usr/local\nLibs: -lextism\n",
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// githubTransport answers Github API and release download requests using
+// handler, so lib install can be tested without network access
+type githubTransport struct {
+	handler http.Handler
+}
+
+func (g githubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	g.handler.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+// fakeGithubRelease serves a single v1.0.0 release containing tarball and a
+// SHA256SUMS file with the contents of sums
+func fakeGithubRelease(t *testing.T, tarball []byte, sums string) {
+	name := "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz"
+	download := "https://github.com/extism/extism/releases/download/v1.0.0/"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/extism/extism/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"tag_name": "v1.0.0", "created_at": "2024-01-01T00:00:00Z", "assets": [
+			{"name": %q, "browser_download_url": %q},
+			{"name": "SHA256SUMS", "browser_download_url": %q}]}]`, name, download+name, download+"SHA256SUMS")
+	})
+	mux.HandleFunc("/extism/extism/releases/download/v1.0.0/"+name, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	})
+	mux.HandleFunc("/extism/extism/releases/download/v1.0.0/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sums)
+	})
+
+	transport := http.DefaultTransport
+	http.DefaultTransport = githubTransport{mux}
+	t.Cleanup(func() { http.DefaultTransport = transport })
+	t.Setenv("EXTISM_CACHE_DIR", t.TempDir())
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	tmp := t.TempDir()
+	tarball := libTarball(t, map[string]string{"extism.h": "header"})
+	fakeGithubRelease(t, tarball, sha256Hex([]byte("other"))+"  libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz\n")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--version", "v1.0.0", "--triplet", "x86_64-unknown-linux-gnu", "--prefix", filepath.Join(tmp, "prefix")})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatal("expected a checksum mismatch, got", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "prefix")); err == nil {
+		t.Error("files were installed despite the checksum mismatch")
+	}
+}
+
+func TestInstallFromFile(t *testing.T) {
+	tmp := t.TempDir()
+	data := libTarball(t, libTarballFiles)
+	tarball := filepath.Join(tmp, "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz")
+	if err := os.WriteFile(tarball, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := filepath.Join(tmp, "prefix")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--from", tarball, "--triplet", "x86_64-unknown-linux-gnu", "--sha256", sha256Hex(data), "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"lib/libextism.so", "lib/libextism.a", "include/extism.h", "lib/pkgconfig/extism.pc"} {
+		if _, err := os.Stat(filepath.Join(prefix, filepath.FromSlash(f))); err != nil {
+			t.Error("missing installed file", err)
+		}
+	}
+	pc, err := os.ReadFile(filepath.Join(prefix, "lib", "pkgconfig", "extism.pc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pc), "prefix="+prefix) {
+		t.Error("expected pkg-config prefix to be rewritten", string(pc))
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--from", tarball, "--triplet", "x86_64-unknown-linux-gnu", "--sha256", sha256Hex([]byte("other")), "--prefix", filepath.Join(tmp, "mismatch")})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatal("expected a checksum mismatch, got", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "mismatch")); err == nil {
+		t.Error("expected nothing to be installed after a checksum mismatch")
+	}
+}
+
+func TestLibUse(t *testing.T) {
+	tmp := t.TempDir()
+	prefix := filepath.Join(tmp, "prefix")
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		files := map[string]string{"libextism.so": version, "extism.h": version}
+		tarball := filepath.Join(tmp, "libextism-x86_64-unknown-linux-gnu-"+version+".tar.gz")
+		if err := os.WriteFile(tarball, libTarball(t, files), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := rootCmd()
+		cmd.SetArgs([]string{"lib", "install", "--from", tarball, "--triplet", "x86_64-unknown-linux-gnu", "--prefix", prefix})
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	installed := func() string {
+		data, err := os.ReadFile(filepath.Join(prefix, "lib", "libextism.so"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if v := installed(); v != "v1.1.0" {
+		t.Error("expected the most recent install to be active, got", v)
+	}
+
+	var out bytes.Buffer
+	cmd := rootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"lib", "list", "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "  v1.0.0\n* v1.1.0\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "use", "1.0.0", "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if v := installed(); v != "v1.0.0" {
+		t.Error("expected v1.0.0 to be active, got", v)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "use", "v2.0.0", "--prefix", prefix})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an error using a version that isn't installed")
+	}
+}
+
+func TestLibUninstallReceipt(t *testing.T) {
+	tmp := t.TempDir()
+	prefix := filepath.Join(tmp, "prefix")
+	tarball := filepath.Join(tmp, "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz")
+	if err := os.WriteFile(tarball, libTarball(t, libTarballFiles), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--from", tarball, "--triplet", "x86_64-unknown-linux-gnu", "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := os.ReadFile(filepath.Join(prefix, "lib", "extism", "v1.0.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(receipt), `"triplet": "x86_64-unknown-linux-gnu"`) {
+		t.Error("expected triplet in receipt", string(receipt))
+	}
+
+	installed := []string{"lib/libextism.so", "include/extism.h", "lib/extism/v1.0.0/libextism.so"}
+	exists := func(f string) bool {
+		_, err := os.Lstat(filepath.Join(prefix, filepath.FromSlash(f)))
+		return err == nil
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "uninstall", "--prefix", prefix, "--dry-run"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range installed {
+		if !exists(f) {
+			t.Error("dry run removed", f)
+		}
+	}
+
+	header := filepath.Join(prefix, "lib", "extism", "v1.0.0", "extism.h")
+	if err := os.WriteFile(header, []byte("modified"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "uninstall", "--prefix", prefix})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Fatal("expected an error for modified files, got", err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "uninstall", "--prefix", prefix, "--force"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range append(installed, "lib/extism/v1.0.0", "lib/extism/v1.0.0.json", "lib/pkgconfig/extism.pc") {
+		if exists(f) {
+			t.Error("expected file to be removed", f)
+		}
+	}
+}
+
+// releaseServer serves a release list in the Github API format, along with the
+// release tarballs and checksums
+func releaseServer(t *testing.T) *httptest.Server {
+	data := libTarball(t, libTarballFiles)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	type asset struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+		Url  string `json:"browser_download_url"`
+	}
+	type release struct {
+		Tag        string  `json:"tag_name"`
+		Prerelease bool    `json:"prerelease"`
+		Created    string  `json:"created_at"`
+		Published  string  `json:"published_at"`
+		Assets     []asset `json:"assets"`
+	}
+
+	releases := []release{}
+	for i, tag := range []string{"v0.5.0", "v1.0.0", "v1.1.0", "v2.0.0-rc1"} {
+		name := "libextism-x86_64-unknown-linux-gnu-" + tag + ".tar.gz"
+		sums := fmt.Sprintf("%s  %s\n", sha256Hex(data), name)
+		mux.HandleFunc("/download/"+tag+"/"+name, func(w http.ResponseWriter, r *http.Request) { w.Write(data) })
+		mux.HandleFunc("/download/"+tag+"/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, sums) })
+		date := fmt.Sprintf("2024-0%d-01T00:00:00Z", i+1)
+		releases = append(releases, release{
+			Tag:        tag,
+			Prerelease: strings.Contains(tag, "-"),
+			Created:    date,
+			Published:  date,
+			Assets: []asset{
+				{Name: name, Size: len(data), Url: server.URL + "/download/" + tag + "/" + name},
+				{Name: "SHA256SUMS", Size: len(sums), Url: server.URL + "/download/" + tag + "/SHA256SUMS"},
+			},
+		})
+	}
+	mux.HandleFunc("/releases.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+	return server
+}
+
+func TestLibVersionsFixture(t *testing.T) {
+	server := releaseServer(t)
+	tmp := t.TempDir()
+	t.Setenv("EXTISM_CACHE_DIR", filepath.Join(tmp, "cache"))
+	t.Setenv("EXTISM_RELEASES_URL", server.URL+"/releases.json")
+	prefix := filepath.Join(tmp, "prefix")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--version", "v1.0.0", "--triplet", "x86_64-unknown-linux-gnu", "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := func(args ...string) []map[string]any {
+		var out bytes.Buffer
+		cmd := rootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{"lib", "versions", "--json", "--prefix", prefix}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		var versions []map[string]any
+		if err := json.Unmarshal(out.Bytes(), &versions); err != nil {
+			t.Fatal(err)
+		}
+		return versions
+	}
+	tags := func(versions []map[string]any) string {
+		names := []string{}
+		for _, v := range versions {
+			names = append(names, v["tag"].(string))
+		}
+		return strings.Join(names, ",")
+	}
+
+	if v := tags(versions(">=1.0", "<2")); v != "v1.1.0,v1.0.0" {
+		t.Error("unexpected versions for range:", v)
+	}
+	if v := tags(versions("--prerelease", ">=1.0")); v != "v2.0.0-rc1,v1.1.0,v1.0.0" {
+		t.Error("unexpected versions with pre-releases:", v)
+	}
+	if v := tags(versions()); v != "v1.1.0,v1.0.0,v0.5.0" {
+		t.Error("expected pre-releases to be hidden by default:", v)
+	}
+	if v := versions("--prerelease", "^2.0.0-0"); len(v) != 1 || v[0]["tag"] != "v2.0.0-rc1" || v[0]["prerelease"] != true {
+		t.Error("unexpected pre-release versions:", v)
+	}
+
+	// Tags are matched exactly and combined with any constraint
+	if v := tags(versions("v0.5.0", "v1.1.0")); v != "v1.1.0,v0.5.0" {
+		t.Error("unexpected versions for tags:", v)
+	}
+	if v := tags(versions("v0.5.0", ">=1.1")); v != "v1.1.0,v0.5.0" {
+		t.Error("unexpected versions for a tag and range:", v)
+	}
+	if v := tags(versions("v2.0.0-rc1")); v != "v2.0.0-rc1" {
+		t.Error("expected a pre-release tag to be listed:", v)
+	}
+
+	// Release metadata is cached, so the server is no longer needed
+	server.Close()
+	for _, v := range versions("v1.0.0") {
+		if v["active"] != true || v["installed"] != true {
+			t.Error("expected v1.0.0 to be installed and active", v)
+		}
+		assets := v["assets"].([]any)
+		if len(assets) != 1 || assets[0].(map[string]any)["triplet"] != "x86_64-unknown-linux-gnu" {
+			t.Error("unexpected assets", assets)
+		}
+	}
+}
+
+func TestLibDoctor(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the test tarball contains a Linux installation")
+	}
+
+	tmp := t.TempDir()
+	prefix := filepath.Join(tmp, "prefix")
+	tarball := filepath.Join(tmp, "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz")
+	if err := os.WriteFile(tarball, libTarball(t, libTarballFiles), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--from", tarball, "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	pc := filepath.Join(prefix, "lib", "extism", "v1.0.0", "extism.pc")
+	if err := os.WriteFile(pc, []byte("prefix=/somewhere/else\nLibs: -lextism\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cmd = rootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"lib", "doctor", "--prefix", prefix})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected doctor to find problems")
+	}
+
+	for _, s := range []string{"unable to load", "has prefix /somewhere/else", "found " + filepath.Join(prefix, "include", "extism.h") + " (version v1.0.0)"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected output to contain %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestLibFlags(t *testing.T) {
+	prefix := t.TempDir()
+	include := filepath.Join(prefix, "include")
+	lib := filepath.Join(prefix, "lib")
+	flags := func(args ...string) string {
+		var out bytes.Buffer
+		cmd := rootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{"lib", "flags", "--prefix", prefix}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+
+	if out := flags("--os", "linux", "--cflags"); out != "-I"+include {
+		t.Error("unexpected cflags:", out)
+	}
+	if out := flags("--os", "linux", "--libs"); out != "-L"+lib+" -Wl,-rpath,"+lib+" -lextism" {
+		t.Error("unexpected libs:", out)
+	}
+	if out := flags("--os", "darwin", "--libs"); !strings.HasSuffix(out, "-lextism -framework Security") {
+		t.Error("expected -framework Security on darwin:", out)
+	}
+	if out := flags("--os", "linux", "--libs", "--static"); !strings.HasPrefix(out, filepath.Join(lib, "libextism.a")+" ") {
+		t.Error("expected the static library path:", out)
+	}
+	if out := flags("--os", "linux", "--format", "cmake"); !strings.Contains(out, "add_library(extism SHARED IMPORTED)") {
+		t.Error("unexpected cmake output:", out)
+	}
+	if out := flags("--os", "linux", "--format", "meson"); !strings.Contains(out, "extism_dep = declare_dependency(") {
+		t.Error("unexpected meson output:", out)
+	}
+	if out := flags("--os", "linux", "--format", "bazel", "--static"); !strings.Contains(out, `static_library = "lib/libextism.a"`) {
+		t.Error("unexpected bazel output:", out)
+	}
+}
+
+func TestInstallPathTraversal(t *testing.T) {
+	tmp := t.TempDir()
+	tarball := libTarball(t, map[string]string{"../../evil.h": "evil"})
+	fakeGithubRelease(t, tarball, sha256Hex(tarball)+"  libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz\n")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--version", "v1.0.0", "--triplet", "x86_64-unknown-linux-gnu", "--prefix", filepath.Join(tmp, "prefix")})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid path") {
+		t.Fatal("expected an invalid path error, got", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "evil.h")); err == nil {
+		t.Error("file was written outside of the prefix")
+	}
+}
+
+func TestInstallFromMirror(t *testing.T) {
+	data := libTarball(t, libTarballFiles)
+	name := "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.0.0/"+name, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	// Mirrors of Github releases may only have a combined checksum file
+	mux.HandleFunc("/v1.0.0/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  libextism-aarch64-apple-darwin-v1.0.0.tar.gz\n", sha256Hex([]byte("other")))
+		fmt.Fprintf(w, "%s  %s\n", sha256Hex(data), name)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	prefix := filepath.Join(t.TempDir(), "prefix")
+	t.Setenv("EXTISM_LIB_MIRROR", server.URL)
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "install", "--version", "v1.0.0", "--triplet", "x86_64-unknown-linux-gnu", "--prefix", prefix})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "lib", "libextism.so")); err != nil {
+		t.Error("missing installed file", err)
+	}
+}
+
+func TestInstallChecksum(t *testing.T) {
+	data := libTarball(t, libTarballFiles)
+	name := "libextism-x86_64-unknown-linux-gnu-v1.0.0.tar.gz"
+	sums := map[string]string{
+		"v1.0.0": fmt.Sprintf("%s  %s\n", sha256Hex([]byte("tampered")), name),
+	}
+	mux := http.NewServeMux()
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		name := strings.Replace(name, "v1.0.0", version, 1)
+		mux.HandleFunc("/"+version+"/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+		mux.HandleFunc("/"+version+"/"+name+".sha256", func(w http.ResponseWriter, r *http.Request) {
+			if sum, ok := sums[version]; ok {
+				fmt.Fprint(w, sum)
+			} else {
+				http.NotFound(w, r)
+			}
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	prefix := filepath.Join(t.TempDir(), "prefix")
+	install := func(args ...string) error {
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"lib", "install", "--mirror", server.URL, "--triplet", "x86_64-unknown-linux-gnu", "--prefix", prefix}, args...))
+		return cmd.Execute()
+	}
+
+	if err := install("--version", "v1.0.0"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatal("expected a checksum mismatch, got", err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "lib", "libextism.so")); err == nil {
+		t.Error("tarball was installed after a checksum mismatch")
+	}
+
+	// v1.1.0 has no published checksum
+	if err := install("--version", "v1.1.0"); err == nil || !strings.Contains(err.Error(), "no checksum available") {
+		t.Fatal("expected a missing checksum error, got", err)
+	}
+	if err := install("--version", "v1.1.0", "--skip-checksum"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(prefix, "lib", "libextism.so")); err != nil {
+		t.Error("missing installed file", err)
+	}
+}
+
+func TestLibVendor(t *testing.T) {
+	tarballs := map[string][]byte{
+		"x86_64-unknown-linux-gnu": libTarball(t, libTarballFiles),
+		"aarch64-apple-darwin": libTarball(t, map[string]string{
+			"libextism.dylib": "dylib",
+			"extism.h":        "#define EXTISM_VERSION \"v1.0.0\"\n",
+			"extism.pc.in":    "prefix=/usr/local\nlibdir=${prefix}/lib\nLibs: -L${libdir} -lextism\n",
+		}),
+	}
+	mux := http.NewServeMux()
+	for triplet := range tarballs {
+		name := "libextism-" + triplet + "-v1.0.0.tar.gz"
+		mux.HandleFunc("/v1.0.0/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Write(tarballs[triplet])
+		})
+		mux.HandleFunc("/v1.0.0/"+name+".sha256", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s  %s\n", sha256Hex(tarballs[triplet]), name)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "third_party", "extism")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "vendor", "--mirror", server.URL, "--version", "v1.0.0", "--dir", dir,
+		"--triplet", "x86_64-unknown-linux-gnu", "--triplet", "aarch64-apple-darwin"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"x86_64-unknown-linux-gnu/lib/libextism.so",
+		"x86_64-unknown-linux-gnu/include/extism.h",
+		"aarch64-apple-darwin/lib/libextism.dylib",
+		"aarch64-apple-darwin/include/extism.h",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Error("missing vendored file", err)
+		}
+	}
+	pc, err := os.ReadFile(filepath.Join(dir, "aarch64-apple-darwin", "lib", "extism.pc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pc), "prefix=${pcfiledir}/..") || !strings.Contains(string(pc), "-framework Security") {
+		t.Error("unexpected pkg-config file", string(pc))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "extism.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock struct {
+		Version string `json:"version"`
+		Assets  []struct {
+			Triplet string `json:"triplet"`
+			Sha256  string `json:"sha256"`
+		} `json:"assets"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		t.Fatal(err)
+	}
+	if lock.Version != "v1.0.0" || len(lock.Assets) != 2 {
+		t.Fatal("unexpected lockfile", string(data))
+	}
+	for _, asset := range lock.Assets {
+		if asset.Sha256 != sha256Hex(tarballs[asset.Triplet]) {
+			t.Error("unexpected checksum for", asset.Triplet)
+		}
+	}
+
+	// Vendoring one triplet keeps the others in the lockfile
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "vendor", "--mirror", server.URL, "--version", "v1.0.0", "--dir", dir, "--triplet", "aarch64-apple-darwin"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "extism.lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Assets) != 2 {
+		t.Fatal("expected both triplets to be locked", string(data))
+	}
+
+	// Fetch the locked files again
+	if err := os.RemoveAll(filepath.Join(dir, "x86_64-unknown-linux-gnu")); err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "vendor", "--dir", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x86_64-unknown-linux-gnu", "lib", "libextism.so")); err != nil {
+		t.Error("missing vendored file", err)
+	}
+
+	// Locked checksums must match
+	tarballs["x86_64-unknown-linux-gnu"] = libTarball(t, map[string]string{"libextism.so": "changed"})
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"lib", "vendor", "--dir", dir})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected checksum mismatch")
+	}
+}
+
+func TestLibCallMissingLibrary(t *testing.T) {
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"lib", "call", "--lib", filepath.Join(t.TempDir(), "libextism.so"), "../test/code.wasm", "count_vowels"})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "unable to open") {
+		t.Error("expected an error opening libextism, got", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	cases := filepath.Join(t.TempDir(), "cases.yaml")
+	if err := os.WriteFile(cases, []byte("cases:\n  - name: vowels\n    wasm: ../test/code.wasm\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"conformance", "--cases", cases})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "has no function") {
+		t.Error("expected an invalid case error, got", err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"conformance", "--lib", filepath.Join(t.TempDir(), "libextism.so"), "../test/code.wasm", "count_vowels", "-i", "aaa"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "unable to open") {
+		t.Error("expected an error opening libextism, got", err)
+	}
+}
+
+func TestSelfUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows releases are zip archives")
+	}
+
+	archive := libTarball(t, map[string]string{"extism": "new executable", "LICENSE": "license"})
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	type asset struct {
+		Name string `json:"name"`
+		Url  string `json:"browser_download_url"`
+	}
+	type release struct {
+		Tag        string  `json:"tag_name"`
+		Prerelease bool    `json:"prerelease"`
+		Assets     []asset `json:"assets"`
+	}
+	releases := []release{}
+	for _, tag := range []string{"v1.0.0", "v1.1.0", "v1.2.0-rc1"} {
+		assets := []asset{}
+		for _, platform := range []string{runtime.GOOS + "-" + runtime.GOARCH, "plan9-mips"} {
+			name := "extism-" + tag + "-" + platform + ".tar.gz"
+			data := archive
+			if platform == "plan9-mips" {
+				data = []byte("other platform")
+			}
+			mux.HandleFunc("/"+tag+"/"+name, func(w http.ResponseWriter, r *http.Request) { w.Write(data) })
+			mux.HandleFunc("/"+tag+"/"+name+".sha256", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, sha256Hex(data)) })
+			assets = append(assets,
+				asset{Name: name + ".sha256", Url: server.URL + "/" + tag + "/" + name + ".sha256"},
+				asset{Name: name, Url: server.URL + "/" + tag + "/" + name})
+		}
+		// The checksum for another platform is listed first
+		for i, j := 0, len(assets)-1; i < j; i, j = i+1, j-1 {
+			assets[i], assets[j] = assets[j], assets[i]
+		}
+		releases = append(releases, release{Tag: tag, Prerelease: strings.Contains(tag, "-"), Assets: assets})
+	}
+	mux.HandleFunc("/releases.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+
+	tmp := t.TempDir()
+	t.Setenv("EXTISM_CACHE_DIR", filepath.Join(tmp, "cache"))
+	t.Setenv("EXTISM_CLI_RELEASES_URL", server.URL+"/releases.json")
+
+	var out bytes.Buffer
+	cmd := rootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"version", "--check"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "v1.1.0") {
+		t.Error("expected the latest release to be v1.1.0:", out.String())
+	}
+
+	exe := filepath.Join(tmp, "extism")
+	if err := os.WriteFile(exe, []byte("old executable"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"self-update", "--path", exe, "--sha256", sha256Hex([]byte("wrong"))})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "old executable" {
+		t.Error("executable was replaced after a checksum mismatch")
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"self-update", "--path", exe, "--version", "1.0.0"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new executable" {
+		t.Error("unexpected executable contents:", string(data))
+	}
+	if fi, err := os.Stat(exe); err != nil || fi.Mode().Perm() != 0o750 {
+		t.Error("expected the executable mode to be kept", fi.Mode(), err)
+	}
+}
+
 func TestCall(t *testing.T) {
 	cmd := rootCmd()
 	cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa"})
@@ -66,3 +825,740 @@ func TestInstall(t *testing.T) {
 
 	exec.Command("rm", "-rf", "tmp").Run()
 }
+
+func TestRepl(t *testing.T) {
+	cmd := rootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetIn(strings.NewReader("functions\nconfig set thing 123\nconfig\ncall count_vowels aaa\nreset\nexit\n"))
+	cmd.SetArgs([]string{"repl", "../test/code.wasm", "--history", ""})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"count_vowels\n", "thing=123\n", `"count":3`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected output to contain %q, got: %s", s, out.String())
+		}
+	}
+}
+
+// wasmLogger builds a plugin that exports `run`, which logs message at the info
+// level using the Extism runtime functions. The message has to be shorter than
+// 64 bytes to keep the encoding simple.
+func wasmLogger(message string) []byte {
+	vec := func(items ...[]byte) []byte {
+		out := []byte{byte(len(items))}
+		for _, item := range items {
+			out = append(out, item...)
+		}
+		return out
+	}
+	section := func(id byte, body []byte) []byte {
+		return append([]byte{id, byte(len(body))}, body...)
+	}
+	str := func(s string) []byte {
+		return append([]byte{byte(len(s))}, s...)
+	}
+	imp := func(name string, typ byte) []byte {
+		return append(append(str("extism:host/env"), str(name)...), 0x00, typ)
+	}
+
+	// alloc the message, store it byte by byte and pass its offset to log_info
+	code := []byte{0x01, 0x01, 0x7e, 0x42, byte(len(message)), 0x10, 0x00, 0x21, 0x00}
+	for i := 0; i < len(message); i++ {
+		// i32.const takes a signed LEB128, so bytes >= 64 need a second byte
+		c := []byte{message[i]}
+		if message[i] >= 0x40 {
+			c = []byte{message[i]&0x7f | 0x80, message[i] >> 7}
+		}
+		code = append(code, 0x20, 0x00, 0x42, byte(i), 0x7c, 0x41)
+		code = append(code, c...)
+		code = append(code, 0x10, 0x01)
+	}
+	code = append(code, 0x20, 0x00, 0x10, 0x02, 0x41, 0x00, 0x0b)
+
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	wasm = append(wasm, section(1, vec(
+		[]byte{0x60, 0x01, 0x7e, 0x01, 0x7e},
+		[]byte{0x60, 0x02, 0x7e, 0x7f, 0x00},
+		[]byte{0x60, 0x01, 0x7e, 0x00},
+		[]byte{0x60, 0x00, 0x01, 0x7f},
+	))...)
+	wasm = append(wasm, section(2, vec(imp("alloc", 0), imp("store_u8", 1), imp("log_info", 2)))...)
+	wasm = append(wasm, section(3, vec([]byte{0x03}))...)
+	wasm = append(wasm, section(7, vec(append(str("run"), 0x00, 0x03)))...)
+	return append(wasm, section(10, vec(append([]byte{byte(len(code))}, code...)))...)
+}
+
+func TestCallLogFormat(t *testing.T) {
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--log-format", "yaml"})
+	err := cmd.Execute()
+	if err == nil {
+		t.Error("expected invalid log format to fail")
+	}
+
+	tmp := t.TempDir()
+	plugin := filepath.Join(tmp, "logger.wasm")
+	if err := os.WriteFile(plugin, wasmLogger("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(tmp, "plugin.log")
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", plugin, "run", "--log-level", "info", "--log-format", "json", "--log-file", logFile, "--loop", "2"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for call := 0; call < 2; call++ {
+		var record struct {
+			Level     string    `json:"level"`
+			Message   string    `json:"message"`
+			Timestamp time.Time `json:"timestamp"`
+			Call      int       `json:"call"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal("expected a log record for each call:", err, string(data))
+		}
+		if record.Level != "info" || record.Message != "hello" || record.Call != call || record.Timestamp.IsZero() {
+			t.Error("unexpected log record", record)
+		}
+	}
+}
+
+func TestCallWasiOptions(t *testing.T) {
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--env", "A=1"})
+	err := cmd.Execute()
+	if err == nil {
+		t.Error("expected WASI options without --wasi to fail")
+	}
+
+	dir := t.TempDir()
+	// The stdio files are closed after each call, the second call must not
+	// reuse a plugin with closed files
+	for i := 0; i < 2; i++ {
+		cmd = rootCmd()
+		cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--wasi",
+			"--env", "A=1", "--wasi-arg", "plugin", "--wasi-stdout", filepath.Join(dir, "stdout"),
+			"--allow-path", "ro:" + dir + ":/data"})
+		err = cmd.Execute()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCallLayeredManifests(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	overrides := filepath.Join(dir, "overrides.toml")
+	err := os.WriteFile(base, []byte("wasm:\n  - path: ${WASM_PATH}\nconfig:\n  a: ${A:-1}\n  b: \"2\"\n  port: 8080\n  debug: true\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(overrides, []byte("[config]\nb = \"3\"\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("WASM_PATH", "../test/code.wasm")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"call", "--manifest-file", base, "--manifest-file", overrides, "count_vowels", "-i", "aaa"})
+	err = cmd.Execute()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// With -m the positional argument is a manifest, JSON manifests aren't
+	// expanded
+	manifest := filepath.Join(dir, "manifest.json")
+	err = os.WriteFile(manifest, []byte(`{"wasm": [{"path": "../test/code.wasm"}], "config": {"template": "${NOT_SET}"}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", manifest, "count_vowels", "-m", "-i", "aaa"})
+	err = cmd.Execute()
+	if err != nil {
+		t.Error(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", manifest, "count_vowels", "-m", "--manifest-file", overrides, "-i", "aaa"})
+	err = cmd.Execute()
+	if err != nil {
+		t.Error(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", "-m", filepath.Join(dir, "missing.json"), "count_vowels"})
+	err = cmd.Execute()
+	if err == nil {
+		t.Error("expected missing manifest to fail")
+	}
+}
+
+func TestWasmCacheTTL(t *testing.T) {
+	t.Setenv("EXTISM_CACHE_DIR", t.TempDir())
+	requests := 0
+	files := http.FileServer(http.Dir("../test"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	url := server.URL + "/code.wasm"
+
+	// The config is changed for each call so the plugin isn't reused
+	call := func(i int, args ...string) {
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"call", url, "count_vowels", "-i", "aaa", "--config", fmt.Sprintf("call=%d", i)}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	call(1)
+	call(2)
+	if requests != 1 {
+		t.Error("expected the cached module to be used, got", requests, "requests")
+	}
+
+	call(3, "--refresh")
+	if requests != 2 {
+		t.Error("expected --refresh to download the module, got", requests, "requests")
+	}
+
+	t.Setenv("EXTISM_WASM_TTL", "0")
+	call(4)
+	if requests != 3 {
+		t.Error("expected an expired module to be downloaded, got", requests, "requests")
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	t.Setenv("EXTISM_CACHE_DIR", t.TempDir())
+	server := httptest.NewServer(http.FileServer(http.Dir("../test")))
+	defer server.Close()
+	url := server.URL + "/code.wasm"
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"call", url, "count_vowels", "-i", "aaa", "--offline"})
+	err := cmd.Execute()
+	if err == nil {
+		t.Error("expected uncached module to fail when offline")
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"fetch", url})
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -m reads the modules to fetch from a manifest, like `extism call`
+	manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(manifest, []byte("wasm:\n  - url: "+url+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"fetch", "-m", manifest})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Close()
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", url, "count_vowels", "-i", "aaa", "--offline"})
+	err = cmd.Execute()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// An explicit fetch fails instead of using the cached copy
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"fetch", url})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected fetch to fail when the module can't be downloaded")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key")
+	wasm := filepath.Join(dir, "code.wasm")
+	data, err := os.ReadFile("../test/code.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(wasm, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"sign", "--generate-key", key, wasm})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"verify", "--trusted-key", key + ".pub", wasm})
+	if err := cmd.Execute(); err != nil {
+		t.Error(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", wasm, "count_vowels", "-i", "aaa", "--require-signature", "--trusted-key", key + ".pub"})
+	if err := cmd.Execute(); err != nil {
+		t.Error(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", wasm, "count_vowels", "-i", "aaa", "--require-signature", "--trusted-key", key + ".pub", "--link", "other=../test/code.wasm"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected unsigned linked module to fail")
+	}
+
+	if err := os.WriteFile(wasm, append(data, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"verify", "--trusted-key", key + ".pub", wasm})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected tampered module to fail")
+	}
+}
+
+func TestPipe(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "pipe.yaml")
+	err := os.WriteFile(spec, []byte(`stages:
+  - wasm: ../test/code.wasm
+    function: count_vowels
+  - name: count-again
+    wasm: ../test/code.wasm
+    function: count_vowels
+    config:
+      vowels: "{}"
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The output of each stage is the input to the next one
+	pipe := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		cmd := rootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return strings.TrimSpace(out.String()), err
+	}
+
+	out, err := pipe("pipe", spec, "-i", "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `{"count":2,`) {
+		t.Error("expected the second stage to count the braces in the first stage output, got", out)
+	}
+
+	out, err = pipe("call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--then", "../test/code.wasm:count_vowels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `{"count":16,`) {
+		t.Error("expected the second stage to count the vowels in the first stage output, got", out)
+	}
+
+	// --manifest only applies to the first stage
+	manifest := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(manifest, []byte(`{"wasm": [{"path": "../test/code.wasm"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = pipe("call", "-m", manifest, "count_vowels", "-i", "aaa", "--then", "../test/code.wasm:count_vowels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `{"count":16,`) {
+		t.Error("unexpected output using a manifest with --then", out)
+	}
+
+	_, err = pipe("call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--then", "../test/code.wasm:missing")
+	if err == nil || !strings.Contains(err.Error(), "stage 2") {
+		t.Error("expected error identifying the failing stage, got:", err)
+	}
+	_, err = pipe("call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--then", "../test/missing.wasm:count_vowels")
+	if err == nil || !strings.Contains(err.Error(), "stage 2") {
+		t.Error("expected error identifying the stage that can't be created, got:", err)
+	}
+}
+
+func TestCallSchema(t *testing.T) {
+	schema := `version: v1-draft
+exports:
+  count_vowels:
+    input:
+      type: string
+      contentType: text/plain; charset=utf-8
+    output:
+      $ref: "#/components/schemas/VowelReport"
+      contentType: application/json
+components:
+  schemas:
+    VowelReport:
+      properties:
+        count:
+          type: %s
+          format: int32
+        total:
+          type: integer
+        vowels:
+          type: string
+`
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(valid, []byte(fmt.Sprintf(schema, "integer")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte(fmt.Sprintf(schema, "string")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--schema", valid})
+	if err := cmd.Execute(); err != nil {
+		t.Error(err)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"call", "../test/code.wasm", "count_vowels", "-i", "aaa", "--schema", invalid})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "$.count: expected string, got number") {
+		t.Error("expected output validation to fail, got:", err)
+	}
+}
+
+func TestGenerateCustomTemplate(t *testing.T) {
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "extism")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@extism.org")
+	}
+
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "internal-template")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "README.md"), []byte("internal"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registry := filepath.Join(tmp, "templates.json")
+	if err := os.WriteFile(registry, []byte(`[{"name": "Internal", "url": "./internal-template"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "plugin")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--lang", "internal", "-o", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "internal" {
+		t.Error("unexpected template contents", string(data))
+	}
+}
+
+func TestGenerateTemplateVariables(t *testing.T) {
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "extism")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@extism.org")
+	}
+
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "template")
+	if err := os.MkdirAll(filepath.Join(src, "cmd", "{{project_name}}"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"extism-template.json": `{
+			"variables": [{"name": "greeting", "prompt": "Greeting", "default": "hello from {{project_name}}"}],
+			"hooks": ["git tag {{project_name}}"]
+		}`,
+		"go.mod":                        "module {{module_path}}\n",
+		"cmd/{{project_name}}/main.txt": "{{greeting}} by {{author}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := filepath.Join(tmp, "templates.json")
+	if err := os.WriteFile(registry, []byte(`[{"name": "Vars", "url": "./template"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "my-plugin")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--lang", "vars", "-o", dir,
+		"--var", "module_path=example.com/my-plugin", "--var", "author=Extism", "--allow-hooks"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"go.mod":                 "module example.com/my-plugin\n",
+		"cmd/my-plugin/main.txt": "hello from my-plugin by Extism",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("expected %s to contain %q, got %q", name, content, string(data))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "extism-template.json")); err == nil {
+		t.Error("expected extism-template.json to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "refs", "tags", "my-plugin")); err != nil {
+		t.Error("expected post-generate hook to run", err)
+	}
+
+	// Hooks aren't run without a terminal unless they're allowed
+	dir = filepath.Join(tmp, "no-hooks")
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--lang", "vars", "-o", dir, "--var", "author=Extism"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "refs", "tags", "no-hooks")); err == nil {
+		t.Error("expected post-generate hook to be skipped")
+	}
+}
+
+func TestGenerateList(t *testing.T) {
+	var out bytes.Buffer
+	cmd := rootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"generate", "list", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	var templates []struct {
+		Name string   `json:"name"`
+		Type string   `json:"type"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &templates); err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, tmpl := range templates {
+		found[tmpl.Type+":"+tmpl.Name] = true
+	}
+	for _, name := range []string{"plugin:Rust", "plugin:Go", "host:Go"} {
+		if !found[name] {
+			t.Error("expected template in list:", name)
+		}
+	}
+}
+
+func TestGeneratePluginNonInteractive(t *testing.T) {
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "-o", t.TempDir()})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "use --lang") {
+		t.Fatal("expected an error asking for --lang, got", err)
+	}
+}
+
+func TestGenerateOfflineTemplate(t *testing.T) {
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "extism")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@extism.org")
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("EXTISM_CACHE_DIR", filepath.Join(tmp, "cache"))
+
+	src := filepath.Join(tmp, "template")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "README.md"), []byte("cached"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"init", "--initial-branch=main"}, {"add", "-A"}, {"commit", "-m", "init"}, {"tag", "v1.0.0"}} {
+		git := exec.Command("git", args...)
+		git.Dir = src
+		if out, err := git.CombinedOutput(); err != nil {
+			t.Fatal(string(out), err)
+		}
+	}
+	registry := filepath.Join(tmp, "templates.json")
+	if err := os.WriteFile(registry, []byte(`[{"name": "Cached", "url": "./template"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "fetch", "--templates", registry, "--tag", "v1.0.0", "cached"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The template is no longer available, so it has to come from the cache
+	if err := os.RemoveAll(src); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "plugin")
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--offline", "--tag", "v1.0.0", "--lang", "cached", "-o", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "cached" {
+		t.Error("unexpected template contents", string(data))
+	}
+
+	// Without --offline the cache is used when the template can't be fetched
+	dir = filepath.Join(tmp, "fallback")
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--tag", "v1.0.0", "--lang", "cached", "-o", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README.md")); err != nil {
+		t.Error("expected the cached template to be used", err)
+	}
+
+	// Existing files are never overwritten
+	dir = filepath.Join(tmp, "existing")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--tag", "v1.0.0", "--lang", "cached", "-o", dir})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatal("expected an error for a non-empty output directory, got", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "README.md")); string(data) != "mine" {
+		t.Error("expected existing files to be kept, got", string(data))
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"generate", "plugin", "--templates", registry, "--offline", "--tag", "v2.0.0", "--lang", "cached", "-o", filepath.Join(tmp, "other")})
+	err = cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "cached at tag v1.0.0") {
+		t.Fatal("expected a tag mismatch error, got", err)
+	}
+}
+
+func TestGenerateHost(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "host")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "host", "--lang", "go", "--plugin", "../test/code.wasm", "-o", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"manifest.json", "main.go", "go.mod"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Error("missing generated file", err)
+		}
+	}
+
+	main, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(main), `plugin.Call("count_vowels"`) {
+		t.Error("expected generated host to call count_vowels")
+	}
+}
+
+// wasmImports builds a module that exports `run` and imports functions with no
+// params or results, each import is a `module.name` pair
+func wasmImports(imports ...string) []byte {
+	section := func(id byte, body []byte) []byte {
+		return append([]byte{id, byte(len(body))}, body...)
+	}
+	body := []byte{byte(len(imports))}
+	for _, imp := range imports {
+		module, name, _ := strings.Cut(imp, ".")
+		body = append(body, byte(len(module)))
+		body = append(body, module...)
+		body = append(body, byte(len(name)))
+		body = append(body, name...)
+		body = append(body, 0x00, 0x00)
+	}
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	wasm = append(wasm, section(1, []byte{0x01, 0x60, 0x00, 0x00})...)
+	wasm = append(wasm, section(2, body)...)
+	wasm = append(wasm, section(3, []byte{0x01, 0x00})...)
+	wasm = append(wasm, section(7, []byte{0x01, 0x03, 'r', 'u', 'n', 0x00, byte(len(imports))})...)
+	return append(wasm, section(10, []byte{0x01, 0x02, 0x00, 0x0b})...)
+}
+
+func TestGenerateHostImports(t *testing.T) {
+	tmp := t.TempDir()
+	plugin := filepath.Join(tmp, "plugin.wasm")
+	wasm := wasmImports("env.extism_alloc", "env.lookup", "extism:host/env.alloc", "kv.get", "cache.get")
+	if err := os.WriteFile(plugin, wasm, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "host")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"generate", "host", "--lang", "go", "--plugin", plugin, "-o", dir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	main, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// User defined functions in `env` are kept, runtime functions are not
+	if !strings.Contains(string(main), "fnLookup :=") {
+		t.Error("expected a host function for env::lookup")
+	}
+	if strings.Contains(string(main), `"extism_alloc"`) || strings.Contains(string(main), `"alloc"`) {
+		t.Error("expected runtime imports to be skipped")
+	}
+	for _, ident := range []string{"fnKvGet :=", "fnCacheGet :="} {
+		if !strings.Contains(string(main), ident) {
+			t.Error("expected the namespace in the identifier", ident)
+		}
+	}
+}
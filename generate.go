@@ -6,35 +6,68 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 //go:embed pdk-templates.json
 var templatesData []byte
 
 type pdkTemplate struct {
-	Name string `json:"name"`
-	Url  string `json:"url"`
+	Name        string   `json:"name"`
+	Url         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+type generateArgs struct {
+	lang      string
+	dir       string
+	tag       string
+	plugin    string
+	funcName  string
+	templates []string
+	vars      []string
+	json      bool
+	offline   bool
+	refresh   bool
+
+	allowHooks bool
+	noHooks    bool
+}
+
+func (t pdkTemplate) matches(lang string) bool {
+	if strings.ToLower(t.Name) == lang {
+		return true
+	}
+	for _, tag := range t.Tags {
+		if strings.ToLower(tag) == lang {
+			return true
+		}
+	}
+	return false
 }
 
 func GenerateCmd() *cobra.Command {
-	var lang, dir, tag string
+	gen := &generateArgs{}
 	cmd :=
 		&cobra.Command{
-			Use:          "generate [resource]",
+			Use:          "generate [plugin|host|list|fetch]",
 			Aliases:      []string{"gen"},
-			Short:        "Generate scaffolding for a new Extism resource, e.g. 'plugin'",
-			Example:      "generate plugin",
-			ValidArgs:    []string{"plugin"},
+			Short:        "Generate scaffolding for a new Extism resource, e.g. 'plugin' or 'host'",
+			Example:      "generate plugin\ngenerate host --lang go --plugin plugin.wasm\ngenerate list --json\ngenerate fetch --tag main rust go",
+			ValidArgs:    []string{"plugin", "host", "list", "fetch"},
 			SilenceUsage: true,
 			RunE: func(cmd *cobra.Command, args []string) error {
 				if len(args) == 0 || args[0] == "" {
@@ -43,7 +76,13 @@ func GenerateCmd() *cobra.Command {
 				}
 				switch args[0] {
 				case "plugin":
-					return generatePlugin(lang, dir, tag)
+					return generatePlugin(gen)
+				case "host":
+					return generateHost(gen.lang, gen.dir, gen.plugin, gen.funcName)
+				case "list":
+					return listTemplates(cmd, gen)
+				case "fetch":
+					return fetchTemplates(gen, args[1:])
 				default:
 					cmd.Help()
 					return fmt.Errorf("unsupported resource: '%s'", args[0])
@@ -52,41 +91,39 @@ func GenerateCmd() *cobra.Command {
 		}
 
 	flags := cmd.Flags()
-	flags.StringVarP(&lang, "lang", "l", "", "[optional] The name of the PDK language to generate a plugin scaffold, e.g. 'rust'")
-	flags.StringVarP(&dir, "output", "o", ".", "The path to an output directory where resource scaffolding will be generated")
-	flags.StringVarP(&tag, "tag", "t", "main", "A tag to clone from the template repository")
+	flags.StringVarP(&gen.lang, "lang", "l", "", "[optional] The name of the PDK or SDK language to generate a scaffold for, e.g. 'rust'")
+	flags.StringVarP(&gen.dir, "output", "o", ".", "The path to an output directory where resource scaffolding will be generated")
+	flags.StringVarP(&gen.tag, "tag", "t", "main", "A tag to clone from the template repository")
+	flags.StringArrayVar(&gen.templates, "templates", defaultTemplateSources(),
+		"Additional PDK template list, either a path or URL to a JSON file in the same format as pdk-templates.json, may be repeated. Can also be set using $EXTISM_TEMPLATES as a comma separated list")
+	flags.StringVarP(&gen.plugin, "plugin", "p", "", "The Wasm file or URL of the plugin a host scaffold should load")
+	flags.StringVarP(&gen.funcName, "function", "f", "", "[optional] The plugin function called by a host scaffold, defaults to the first export")
+	flags.BoolVar(&gen.offline, "offline", false, "Only use templates cached using 'generate fetch'")
+	flags.BoolVar(&gen.refresh, "refresh", false, "Update templates that are already cached when running 'generate fetch'")
+	flags.BoolVar(&gen.json, "json", false, "Print the output of 'generate list' as JSON")
+	flags.StringArrayVar(&gen.vars, "var", []string{}, "Set a template variable, e.g. project_name=my-plugin, may be repeated")
+	flags.BoolVar(&gen.allowHooks, "allow-hooks", false, "Run the post-generate commands listed by a template without asking")
+	flags.BoolVar(&gen.noHooks, "no-hooks", false, "Never run the post-generate commands listed by a template")
+	cmd.MarkFlagsMutuallyExclusive("allow-hooks", "no-hooks")
 
 	return cmd
 }
 
-func generatePlugin(lang string, dir, tag string) error {
+func generatePlugin(gen *generateArgs) error {
 	if _, err := exec.LookPath("git"); err != nil {
 		return errors.New("missing `git`, please install before executing this command")
 	}
-	var templates []pdkTemplate
-	data := templatesData
-	res, err := http.Get("https://raw.githubusercontent.com/extism/cli/main/pdk-templates.json")
-	if err == nil && res.StatusCode == 200 {
-		t, err := io.ReadAll(res.Body)
-		if err == nil {
-			data = t
-		}
-		defer res.Body.Close()
-	} else {
-		Log("Unable to fetch PDK templates, falling back to local list")
-	}
-	err = json.Unmarshal(data, &templates)
+	templates, err := loadPdkTemplates(gen.templates, gen.offline)
 	if err != nil {
-		fmt.Println(string(data))
 		return err
 	}
 
-	lang = strings.ToLower(lang)
+	lang := strings.ToLower(gen.lang)
 	if lang != "" {
 		var match bool
 		var pdk pdkTemplate
 		for _, tmpl := range templates {
-			if strings.ToLower(tmpl.Name) == lang {
+			if tmpl.matches(lang) {
 				match = true
 				pdk = tmpl
 				break
@@ -94,14 +131,17 @@ func generatePlugin(lang string, dir, tag string) error {
 		}
 
 		if match {
-			if err := cloneTemplate(pdk, dir, tag); err != nil {
+			if err := cloneTemplate(pdk, gen); err != nil {
 				return err
 			}
 			return nil
 		}
 	} else {
-		pdk := pickPdk(templates)
-		return cloneTemplate(pdk, dir, tag)
+		pdk, err := pickPdk(templates)
+		if err != nil || pdk.Name == "" {
+			return err
+		}
+		return cloneTemplate(pdk, gen)
 	}
 
 	var langs []string
@@ -112,6 +152,136 @@ func generatePlugin(lang string, dir, tag string) error {
 	return fmt.Errorf("unsupported template: '%s'. Supported templates are: %s", lang, strings.Join(langs, ", "))
 }
 
+// defaultTemplateSources returns the custom template lists configured using
+// $EXTISM_TEMPLATES
+func defaultTemplateSources() []string {
+	sources := []string{}
+	for _, s := range strings.Split(os.Getenv("EXTISM_TEMPLATES"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+func readTemplateList(source string) ([]byte, error) {
+	if isRemote(source) {
+		res, err := http.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unable to fetch templates from %s: %s", source, res.Status)
+		}
+		return io.ReadAll(res.Body)
+	}
+	return os.ReadFile(strings.TrimPrefix(source, "file://"))
+}
+
+// loadPdkTemplates returns the built-in PDK templates merged with any custom
+// template lists, custom templates replace built-in templates with the same
+// name. When offline only the embedded list of built-in templates is used.
+func loadPdkTemplates(sources []string, offline bool) ([]pdkTemplate, error) {
+	var templates []pdkTemplate
+	data := templatesData
+	if offline {
+		Log("Offline, using the local list of PDK templates")
+	} else if res, err := http.Get("https://raw.githubusercontent.com/extism/cli/main/pdk-templates.json"); err == nil && res.StatusCode == 200 {
+		defer res.Body.Close()
+		if t, err := io.ReadAll(res.Body); err == nil {
+			data = t
+		}
+	} else {
+		if err == nil {
+			res.Body.Close()
+		}
+		Log("Unable to fetch PDK templates, falling back to local list")
+	}
+	err := json.Unmarshal(data, &templates)
+	if err != nil {
+		fmt.Println(string(data))
+		return nil, err
+	}
+
+	for _, source := range sources {
+		Log("Loading templates from", source)
+		data, err := readTemplateList(source)
+		if err != nil {
+			return nil, err
+		}
+
+		var custom []pdkTemplate
+		if err := json.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("invalid template list %s: %w", source, err)
+		}
+
+	outer:
+		for _, tmpl := range custom {
+			// Local template paths are relative to the template list
+			if !isRemote(source) && !isRemote(tmpl.Url) && !strings.Contains(tmpl.Url, "://") && !filepath.IsAbs(tmpl.Url) {
+				tmpl.Url = filepath.Join(filepath.Dir(strings.TrimPrefix(source, "file://")), tmpl.Url)
+			}
+
+			for i := range templates {
+				if strings.EqualFold(templates[i].Name, tmpl.Name) {
+					templates[i] = tmpl
+					continue outer
+				}
+			}
+			templates = append(templates, tmpl)
+		}
+	}
+
+	return templates, nil
+}
+
+// localTemplateDir returns the path of a template that is a plain directory
+// instead of a git repository
+func localTemplateDir(url string) (string, bool) {
+	path := strings.TrimPrefix(url, "file://")
+	fi, err := os.Stat(path)
+	if err != nil || !fi.IsDir() {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		return "", false
+	}
+	return path, true
+}
+
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
 func runCmdInDir(dir, name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = os.Stdout
@@ -122,8 +292,27 @@ func runCmdInDir(dir, name string, args ...string) error {
 	return cmd.Run()
 }
 
-func cloneTemplate(pdk pdkTemplate, dir, tag string) error {
-	if err := runCmdInDir("", "git", "clone", "--depth=1", pdk.Url, "--branch", tag, "--recurse-submodules", dir); err != nil {
+func cloneTemplate(pdk pdkTemplate, gen *generateArgs) error {
+	dir := gen.dir
+	if err := checkOutputDir(dir); err != nil {
+		return err
+	}
+	local, copied := localTemplateDir(pdk.Url)
+	if copied {
+		Log("Copying template from", local)
+		if err := copyDir(local, dir); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		copied, err = fetchTemplate(pdk, gen)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec, values, err := prepareTemplate(dir, gen.vars)
+	if err != nil {
 		return err
 	}
 
@@ -137,12 +326,29 @@ func cloneTemplate(pdk pdkTemplate, dir, tag string) error {
 		if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
 			return err
 		}
+	} else if copied {
+		// templates copied from a local directory don't have a repository yet
+		if err := runCmdInDir(dir, "git", "init", "--initial-branch=main"); err != nil {
+			return err
+		}
+
+		if err := runCmdInDir(dir, "git", "add", "-A"); err != nil {
+			return err
+		}
+
+		if err := runCmdInDir(dir, "git", "commit", "-m", "init: extism"); err != nil {
+			return err
+		}
 	} else {
 		if err := runCmdInDir(dir, "git", "checkout", "--orphan", "extism-init", "main"); err != nil {
 			return err
 		}
 
-		if err := runCmdInDir(dir, "git", "commit", "-am", "init: extism"); err != nil {
+		if err := runCmdInDir(dir, "git", "add", "-A"); err != nil {
+			return err
+		}
+
+		if err := runCmdInDir(dir, "git", "commit", "-m", "init: extism"); err != nil {
 			return err
 		}
 
@@ -155,11 +361,62 @@ func cloneTemplate(pdk pdkTemplate, dir, tag string) error {
 		}
 	}
 
+	if err := runTemplateHooks(dir, spec, values, gen.allowHooks, gen.noHooks); err != nil {
+		return err
+	}
+
 	fmt.Println("Generated", pdk.Name, "plugin scaffold at", dir)
 
 	return nil
 }
 
+// fetchTemplate clones a template into the output directory, the template
+// cache is used when offline or when the template repository can't be
+// reached. Cached templates are copied without a git repository.
+func fetchTemplate(pdk pdkTemplate, gen *generateArgs) (bool, error) {
+	cache, err := newTemplateCache()
+	if err != nil {
+		return false, err
+	}
+
+	if !gen.offline {
+		// Other clone errors, like a missing tag, aren't hidden by the cache
+		lsRemote := exec.Command("git", "ls-remote", "--exit-code", pdk.Url, "HEAD")
+		err := lsRemote.Run()
+		if err == nil {
+			return false, runCmdInDir("", "git", "clone", "--depth=1", pdk.Url, "--branch", gen.tag, "--recurse-submodules", gen.dir)
+		}
+		cached, cacheErr := cache.get(pdk, gen.tag)
+		if cacheErr != nil {
+			Log(cacheErr)
+			return false, fmt.Errorf("unable to fetch %s: %w", pdk.Url, err)
+		}
+		Print("Unable to fetch", pdk.Url+", using cached template")
+		return true, copyDir(cached, gen.dir)
+	}
+
+	cached, err := cache.get(pdk, gen.tag)
+	if err != nil {
+		return false, err
+	}
+	return true, copyDir(cached, gen.dir)
+}
+
+// checkOutputDir returns an error when dir already has files in it, so
+// generating a project never overwrites existing files
+func checkOutputDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %s is not empty", dir)
+	}
+	return nil
+}
+
 func hasGitRepoInParents(dir string, depth int) bool {
 	parent := filepath.Dir(dir)
 	if depth == 0 || parent == "" || parent == "." || parent == dir {
@@ -191,7 +448,7 @@ var (
 
 type item string
 
-func (i item) FilterValue() string { return "" }
+func (i item) FilterValue() string { return string(i) }
 
 type itemDelegate struct{}
 
@@ -218,6 +475,7 @@ func (d itemDelegate) Render(w io.Writer, m list.Model, index int, listItem list
 
 type model struct {
 	list     list.Model
+	resource string
 	choice   string
 	quitting bool
 }
@@ -233,6 +491,10 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		// Let the list handle keys while the filter is being edited
+		if m.list.FilterState() == list.Filtering && msg.String() != "ctrl+c" {
+			break
+		}
 		switch keypress := msg.String(); keypress {
 		case "q", "ctrl+c":
 			m.quitting = true
@@ -254,7 +516,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *model) View() string {
 	if m.choice != "" {
-		return quitTextStyle.Render(fmt.Sprintf("Generating scaffold for plugin using %s...", m.choice))
+		return quitTextStyle.Render(fmt.Sprintf("Generating scaffold for %s using %s...", m.resource, m.choice))
 	}
 	if m.quitting {
 		return "Operation cancelled."
@@ -262,34 +524,87 @@ func (m *model) View() string {
 	return "\n" + m.list.View()
 }
 
-func pickPdk(pdks []pdkTemplate) pdkTemplate {
+func pickPdk(pdks []pdkTemplate) (pdkTemplate, error) {
 	pdkMap := make(map[string]pdkTemplate, len(pdks))
-	var items []list.Item
+	var names []string
 	for _, pdk := range pdks {
 		pdkMap[pdk.Name] = pdk
-		items = append(items, item(pdk.Name))
+		names = append(names, pdk.Name)
+	}
+
+	choice, err := pickTemplate("Select a PDK language to use for your plugin:", "plugin", names)
+	return pdkMap[choice], err
+}
+
+// pickTemplate prompts for a template, an empty string is returned if the
+// selection is cancelled
+func pickTemplate(title, resource string, names []string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return "", fmt.Errorf("unable to prompt for a %s template outside of an interactive terminal, use --lang to select one of: %s (see `extism generate list`)", resource, strings.Join(names, ", "))
+	}
+
+	var items []list.Item
+	for _, name := range names {
+		items = append(items, item(name))
 	}
 
 	const defaultWidth = 20
 
 	l := list.New(items, itemDelegate{}, defaultWidth, listHeight)
-	l.Title = "Select a PDK language to use for your plugin:"
+	l.Title = title
 	l.SetShowStatusBar(false)
-	l.SetFilteringEnabled(false)
+	l.SetFilteringEnabled(true)
 	l.Styles.Title = titleStyle
 	l.Styles.PaginationStyle = paginationStyle
 	l.Styles.HelpStyle = helpStyle
 
-	m := &model{list: l}
+	m := &model{list: l, resource: resource}
 
 	if _, err := tea.NewProgram(m).Run(); err != nil {
-		fmt.Println("Error running program:", err)
-		os.Exit(1)
+		return "", fmt.Errorf("error running program: %w", err)
 	}
 
-	if m.choice == "" {
-		os.Exit(0)
+	return m.choice, nil
+}
+
+type templateInfo struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Url         string   `json:"url,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// listTemplates prints the available plugin and host templates
+func listTemplates(cmd *cobra.Command, gen *generateArgs) error {
+	pdks, err := loadPdkTemplates(gen.templates, gen.offline)
+	if err != nil {
+		return err
+	}
+	hosts, err := loadHostTemplates()
+	if err != nil {
+		return err
+	}
+
+	templates := []templateInfo{}
+	for _, pdk := range pdks {
+		templates = append(templates, templateInfo{Name: pdk.Name, Type: "plugin", Url: pdk.Url, Description: pdk.Description, Tags: pdk.Tags})
+	}
+	for _, host := range hosts {
+		templates = append(templates, templateInfo{Name: host.Name, Type: "host", Description: host.Description, Tags: host.Aliases})
+	}
+
+	out := cmd.OutOrStdout()
+	if gen.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(templates)
 	}
 
-	return pdkMap[m.choice]
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tTAGS\tDESCRIPTION")
+	for _, t := range templates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, t.Type, strings.Join(t.Tags, ","), t.Description)
+	}
+	return w.Flush()
 }
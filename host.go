@@ -0,0 +1,389 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+//go:embed host-templates.json
+var hostTemplatesData []byte
+
+//go:embed all:host-templates
+var hostTemplatesFS embed.FS
+
+type hostTemplate struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Path        string   `json:"path"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+func (t hostTemplate) matches(lang string) bool {
+	lang = strings.ToLower(lang)
+	if strings.ToLower(t.Name) == lang || t.Path == lang {
+		return true
+	}
+	for _, alias := range t.Aliases {
+		if alias == lang {
+			return true
+		}
+	}
+	return false
+}
+
+type hostFunction struct {
+	Namespace string
+	Name      string
+	// Ident is used to name the function in generated code, it includes the
+	// namespace when the same name is imported from more than one namespace
+	Ident   string
+	Params  []string
+	Results []string
+}
+
+type hostTemplateData struct {
+	Name          string
+	Function      string
+	Exports       []string
+	HostFunctions []hostFunction
+	Wasi          bool
+}
+
+// HostFunctionsByNamespace groups host functions by their import module
+func (d hostTemplateData) HostFunctionsByNamespace() map[string][]hostFunction {
+	m := map[string][]hostFunction{}
+	for _, f := range d.HostFunctions {
+		m[f.Namespace] = append(m[f.Namespace], f)
+	}
+	return m
+}
+
+// Imports provided by the Extism runtime or WASI don't need a host function
+var runtimeImports = map[string]bool{
+	"extism:host/env":        true,
+	"wasi_snapshot_preview1": true,
+}
+
+// Older PDKs import the runtime functions from `env`, which is also the
+// default namespace for user defined host functions, so only these names are
+// skipped
+var legacyRuntimeImports = map[string]bool{
+	"extism_alloc":            true,
+	"extism_free":             true,
+	"extism_length":           true,
+	"extism_length_unsafe":    true,
+	"extism_load_u8":          true,
+	"extism_load_u64":         true,
+	"extism_store_u8":         true,
+	"extism_store_u64":        true,
+	"extism_input_length":     true,
+	"extism_input_offset":     true,
+	"extism_input_load_u8":    true,
+	"extism_input_load_u64":   true,
+	"extism_output_set":       true,
+	"extism_error_set":        true,
+	"extism_config_get":       true,
+	"extism_var_get":          true,
+	"extism_var_set":          true,
+	"extism_http_request":     true,
+	"extism_http_status_code": true,
+	"extism_http_headers":     true,
+	"extism_log_info":         true,
+	"extism_log_warn":         true,
+	"extism_log_error":        true,
+	"extism_log_debug":        true,
+	"extism_log_trace":        true,
+	"extism_get_log_level":    true,
+}
+
+func isRuntimeImport(module, name string) bool {
+	return runtimeImports[module] || (module == "env" && legacyRuntimeImports[name])
+}
+
+// Exports used by PDKs and runtimes that shouldn't be called directly
+var internalExports = map[string]bool{
+	"_start":      true,
+	"_initialize": true,
+	"memory":      true,
+	"call":        true,
+}
+
+func valueTypeName(t api.ValueType) string {
+	switch t {
+	case api.ValueTypeI32:
+		return "i32"
+	case api.ValueTypeF32:
+		return "f32"
+	case api.ValueTypeF64:
+		return "f64"
+	default:
+		return "i64"
+	}
+}
+
+func valueTypeNames(types []api.ValueType) []string {
+	names := []string{}
+	for _, t := range types {
+		names = append(names, valueTypeName(t))
+	}
+	return names
+}
+
+// inspectPlugin lists the exports of a plugin and the host functions it
+// imports
+func inspectPlugin(ctx context.Context, data []byte) (hostTemplateData, error) {
+	info := hostTemplateData{}
+	rt := wazero.NewRuntime(ctx)
+	defer rt.Close(ctx)
+
+	compiled, err := rt.CompileModule(ctx, data)
+	if err != nil {
+		return info, err
+	}
+
+	for _, f := range compiled.ImportedFunctions() {
+		module, name, _ := f.Import()
+		if module == "wasi_snapshot_preview1" {
+			info.Wasi = true
+		}
+		if isRuntimeImport(module, name) {
+			continue
+		}
+		info.HostFunctions = append(info.HostFunctions, hostFunction{
+			Namespace: module,
+			Name:      name,
+			Params:    valueTypeNames(f.ParamTypes()),
+			Results:   valueTypeNames(f.ResultTypes()),
+		})
+	}
+	sort.Slice(info.HostFunctions, func(i, j int) bool {
+		a, b := info.HostFunctions[i], info.HostFunctions[j]
+		return a.Namespace+":"+a.Name < b.Namespace+":"+b.Name
+	})
+	counts := map[string]int{}
+	for _, f := range info.HostFunctions {
+		counts[f.Name]++
+	}
+	for i, f := range info.HostFunctions {
+		info.HostFunctions[i].Ident = f.Name
+		if counts[f.Name] > 1 {
+			info.HostFunctions[i].Ident = f.Namespace + "_" + f.Name
+		}
+	}
+
+	for name := range compiled.ExportedFunctions() {
+		if !internalExports[name] && !strings.HasPrefix(name, "__") {
+			info.Exports = append(info.Exports, name)
+		}
+	}
+	sort.Strings(info.Exports)
+	return info, nil
+}
+
+func identParts(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+var hostTemplateFuncs = template.FuncMap{
+	"goIdent": func(s string) string {
+		parts := identParts(s)
+		for i := range parts {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+		return "fn" + strings.Join(parts, "")
+	},
+	"snakeIdent": func(s string) string {
+		return strings.ToLower(strings.Join(identParts(s), "_"))
+	},
+	"goType": func(t string) string {
+		return "extism.ValueType" + strings.ToUpper(t)
+	},
+	"rustType": func(t string) string {
+		return "ValType::" + strings.ToUpper(t)
+	},
+	"pythonType": func(t string) string {
+		return "extism.ValType." + strings.ToUpper(t)
+	},
+}
+
+func loadHostTemplates() ([]hostTemplate, error) {
+	var templates []hostTemplate
+	err := json.Unmarshal(hostTemplatesData, &templates)
+	return templates, err
+}
+
+// hostManifest creates the manifest used by the generated host, local plugin
+// paths are made relative to the output directory
+func hostManifest(plugin, dir string) (extism.Manifest, error) {
+	manifest := extism.Manifest{}
+	if strings.HasPrefix(plugin, "http://") || strings.HasPrefix(plugin, "https://") {
+		manifest.Wasm = []extism.Wasm{extism.WasmUrl{Url: plugin}}
+		return manifest, nil
+	}
+
+	absPlugin, err := filepath.Abs(plugin)
+	if err != nil {
+		return manifest, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return manifest, err
+	}
+	rel, err := filepath.Rel(absDir, absPlugin)
+	if err != nil {
+		rel = absPlugin
+	}
+	manifest.Wasm = []extism.Wasm{extism.WasmFile{Path: filepath.ToSlash(rel)}}
+	return manifest, nil
+}
+
+func generateHost(lang, dir, plugin, funcName string) error {
+	if plugin == "" {
+		return errors.New("a plugin is required, use --plugin to specify a Wasm file or URL")
+	}
+
+	templates, err := loadHostTemplates()
+	if err != nil {
+		return err
+	}
+
+	var tmpl hostTemplate
+	if lang == "" {
+		names := []string{}
+		for _, t := range templates {
+			names = append(names, t.Name)
+		}
+		choice, err := pickTemplate("Select a language for your host application:", "host", names)
+		if err != nil || choice == "" {
+			return err
+		}
+		for _, t := range templates {
+			if t.Name == choice {
+				tmpl = t
+			}
+		}
+	} else {
+		for _, t := range templates {
+			if t.matches(lang) {
+				tmpl = t
+			}
+		}
+		if tmpl.Name == "" {
+			var langs []string
+			for _, t := range templates {
+				langs = append(langs, t.Name)
+			}
+			return fmt.Errorf("unsupported template: '%s'. Supported templates are: %s", lang, strings.Join(langs, ", "))
+		}
+	}
+
+	ctx := context.Background()
+	manifest, err := hostManifest(plugin, dir)
+	if err != nil {
+		return err
+	}
+
+	var source extism.Wasm = extism.WasmFile{Path: plugin}
+	if u, ok := manifest.Wasm[0].(extism.WasmUrl); ok {
+		source = u
+	}
+	resolved, err := resolveWasm(ctx, []extism.Wasm{source}, false, false)
+	if err != nil {
+		return err
+	}
+	wasm, err := resolved[0].ToWasmData(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := inspectPlugin(ctx, wasm.Data)
+	if err != nil {
+		return fmt.Errorf("unable to inspect plugin: %w", err)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	data.Name = strings.ToLower(strings.Join(identParts(filepath.Base(absDir)), "-"))
+	if data.Name == "" {
+		data.Name = "extism-host"
+	}
+
+	data.Function = funcName
+	if data.Function == "" {
+		if len(data.Exports) == 0 {
+			return errors.New("plugin has no exported functions")
+		}
+		data.Function = data.Exports[0]
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{"manifest.json": append(manifestData, '\n')}
+	root := path.Join("host-templates", tmpl.Path)
+	err = fs.WalkDir(hostTemplatesFS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		src, err := hostTemplatesFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		t, err := template.New(p).Funcs(hostTemplateFuncs).Parse(string(src))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(p, root+"/"), ".tmpl")
+		files[name] = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return fmt.Errorf("%s already exists in %s", name, dir)
+		}
+	}
+
+	for name, content := range files {
+		out := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return err
+		}
+		Log("Writing", out)
+		if err := os.WriteFile(out, content, 0o644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Generated", tmpl.Name, "host scaffold at", dir)
+	return nil
+}
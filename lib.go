@@ -3,12 +3,15 @@ package cli
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -33,10 +36,18 @@ type libInstallArgs struct {
 	arch    string
 	libc    string
 	triplet string
+	sha256  string
+	from    string
+	mirror  string
+
+	skipChecksum bool
 }
 
 type libUninstallArgs struct {
 	libArgs
+	version string
+	dryRun  bool
+	force   bool
 }
 
 func (a *libArgs) SetArgs(args []string) {
@@ -44,18 +55,13 @@ func (a *libArgs) SetArgs(args []string) {
 }
 
 func getReleases(ctx context.Context) (releases []*github.RepositoryRelease, err error) {
-	Log("Fetching releases from Github")
-	client := github.NewClient(nil)
-	if GithubToken != "" {
-		client = client.WithAuthToken(GithubToken)
-	}
-	releases, _, err = client.Repositories.ListReleases(ctx, "extism", "extism", nil)
+	releases, err = cachedReleases(ctx, newReleaseSource())
 	if err != nil {
 		return releases, err
 	}
 	Log("Found", len(releases), "releases")
 	sort.Slice(releases, func(i, j int) bool {
-		return releases[i].CreatedAt.After(releases[j].CreatedAt.Time)
+		return releases[i].GetCreatedAt().After(releases[j].GetCreatedAt().Time)
 	})
 	return releases, nil
 }
@@ -72,6 +78,10 @@ func findRelease(ctx context.Context, tag string) (release *github.RepositoryRel
 		Log("Searching for releases tagged with version:", tag)
 	}
 
+	if len(releases) == 0 {
+		return nil, errors.New("no releases found")
+	}
+
 	if tag == "" {
 		rel := releases[0]
 		if rel.GetTagName() == "latest" {
@@ -117,6 +127,19 @@ func assetPrefix(os, arch, libc string) (string, error) {
 	return "", errors.New("unsupported " + arch + "-" + os + "-" + libc)
 }
 
+// parseTriplet splits a target triplet such as `aarch64-apple-darwin` or
+// `x86_64-unknown-linux-gnu` into its architecture, OS and libc
+func parseTriplet(triplet string) (arch, os, libc string, err error) {
+	parts := strings.Split(triplet, "-")
+	if len(parts) < 3 || len(parts) > 4 {
+		return "", "", "", errors.New("triplet should only have 3 or 4 parts")
+	}
+	if len(parts) == 4 {
+		libc = parts[3]
+	}
+	return parts[0], parts[2], libc, nil
+}
+
 func sharedLibraryName(os string) string {
 	switch os {
 	case "darwin":
@@ -138,25 +161,27 @@ func runLibInstall(cmd *cobra.Command, installArgs *libInstallArgs) error {
 	}
 
 	if installArgs.triplet != "" {
-		parts := strings.Split(installArgs.triplet, "-")
-		if len(parts) >= 3 && len(parts) <= 4 {
-			installArgs.arch = parts[0]
-			installArgs.os = parts[2]
-			installArgs.libc = ""
-			if len(parts) == 4 {
-				installArgs.libc = parts[3]
-			}
-		} else {
-			return errors.New("triplet should only have 3 or 4 parts")
+		var err error
+		installArgs.arch, installArgs.os, installArgs.libc, err = parseTriplet(installArgs.triplet)
+		if err != nil {
+			return err
 		}
 	}
 
-	rel, err := findRelease(cmd.Context(), installArgs.version)
+	if installArgs.from != "" {
+		return installFromFile(installArgs)
+	}
+
+	assetName, err := assetPrefix(installArgs.os, installArgs.arch, installArgs.libc)
 	if err != nil {
 		return err
 	}
 
-	assetName, err := assetPrefix(installArgs.os, installArgs.arch, installArgs.libc)
+	if installArgs.mirror != "" {
+		return installFromMirror(cmd.Context(), assetName, installArgs)
+	}
+
+	rel, err := findRelease(cmd.Context(), installArgs.version)
 	if err != nil {
 		return err
 	}
@@ -165,125 +190,294 @@ func runLibInstall(cmd *cobra.Command, installArgs *libInstallArgs) error {
 	for _, asset := range rel.Assets {
 		if strings.HasPrefix(asset.GetName(), assetName) && strings.HasSuffix(asset.GetName(), ".tar.gz") {
 			Print("Installing", rel.GetTagName(), "to", installArgs.prefix)
+			expected := installArgs.sha256
+			if expected == "" {
+				expected, err = releaseChecksum(cmd.Context(), rel, asset.GetName())
+				if err != nil {
+					return err
+				}
+			}
+
 			url := asset.GetBrowserDownloadURL()
 			Print("Fetching", url)
-			res, err := http.Get(url)
+			data, err := downloadAsset(cmd.Context(), url)
 			if err != nil {
 				return err
 			}
-			defer res.Body.Close()
 
-			Log("Creating gzip reader")
-			r, err := gzip.NewReader(res.Body)
+			return installTarball(asset.GetName(), url, rel.GetTagName(), data, expected, installArgs)
+		} else {
+			Log("Invalid asset:", asset.GetName())
+		}
+
+	}
+
+	return errors.New("No release asset found matching " + assetName)
+}
+
+// installFromFile installs a release tarball from the local filesystem, the
+// checksum is read from `<file>.sha256` when it exists
+func installFromFile(installArgs *libInstallArgs) error {
+	Print("Installing", installArgs.from, "to", installArgs.prefix)
+	data, err := os.ReadFile(installArgs.from)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(installArgs.from)
+	expected := installArgs.sha256
+	if expected == "" {
+		if sums, err := os.ReadFile(installArgs.from + ".sha256"); err == nil {
+			expected = parseChecksum(sums, name)
+		}
+	}
+	version := installArgs.version
+	if version == "" {
+		version = tarballVersion(name)
+	}
+	return installTarball(name, installArgs.from, version, data, expected, installArgs)
+}
+
+// installFromMirror installs a release tarball from a plain HTTP server using
+// the same layout as Github releases: `<mirror>/<version>/<asset>`
+func installFromMirror(ctx context.Context, assetName string, installArgs *libInstallArgs) error {
+	version := installArgs.version
+	if version == "" {
+		return errors.New("--version is required when installing from a mirror")
+	}
+
+	// Builds from git are published as `latest` with assets named after the branch
+	assetVersion := version
+	if version == "latest" {
+		assetVersion = "main"
+	}
+
+	name := assetName + "-" + assetVersion + ".tar.gz"
+	url := strings.TrimSuffix(installArgs.mirror, "/") + "/" + version + "/" + name
+
+	expected := installArgs.sha256
+	if expected == "" {
+		var err error
+		expected, err = mirrorChecksum(ctx, url, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	Print("Installing", version, "to", installArgs.prefix)
+	Print("Fetching", url)
+	data, err := downloadAsset(ctx, url)
+	if err != nil {
+		return err
+	}
+	return installTarball(name, url, version, data, expected, installArgs)
+}
+
+// installTarball verifies the checksum of a release tarball, installs it to
+// the directory for its version and makes it the active version
+func installTarball(name, source, version string, data []byte, expected string, installArgs *libInstallArgs) error {
+	if err := validLibVersion(version); err != nil {
+		return fmt.Errorf("unable to determine the version of %s, use --version to set it: %w", name, err)
+	}
+
+	// Local files aren't published with a checksum, so one is only required
+	// for downloads
+	required := !installArgs.skipChecksum && installArgs.from == ""
+	if err := verifyChecksum(name, data, expected, required); errors.Is(err, errNoChecksum) {
+		return fmt.Errorf("%w, use --sha256 to provide one or --skip-checksum to install without verifying it", err)
+	} else if err != nil {
+		return err
+	}
+
+	dir := libVersionDir(&installArgs.libArgs, version)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := extractLibrary(bytes.NewReader(data), installArgs, dir); err != nil {
+		return err
+	}
+
+	triplet, _ := assetPrefix(installArgs.os, installArgs.arch, installArgs.libc)
+	triplet = strings.TrimPrefix(triplet, "libextism-")
+	if err := writeInstallReceipt(&installArgs.libArgs, version, triplet, source); err != nil {
+		return err
+	}
+	return useLibVersion(&installArgs.libArgs, version)
+}
+
+func downloadAsset(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch %s: %s", url, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// tarEntryName validates the name of a tar entry, names that are absolute or
+// refer to a parent directory are rejected
+func tarEntryName(name string) (string, error) {
+	name = strings.Trim(name, " ")
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(clean) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+func installFile(dir, name string, r io.Reader) error {
+	Log("Creating directory:", dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	Print("Copying", name, "to", out.Name())
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// extractLibrary installs the shared object, static library, header and
+// pkg-config files from a libextism release tarball into dir
+func extractLibrary(r io.Reader, installArgs *libInstallArgs, dir string) error {
+	Log("Creating gzip reader")
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	Log("Reading tar file")
+	tarReader := tar.NewReader(gz)
+
+	for {
+		item, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := tarEntryName(item.Name)
+		if err != nil {
+			return err
+		}
+
+		if item.Typeflag != tar.TypeReg {
+			Log("Skipping", item.Name)
+			continue
+		}
+
+		if strings.HasSuffix(name, getSharedObjectExt(installArgs.os)) {
+			Log("Found shared object file in tarball")
+			if err := installFile(dir, filepath.Base(name), tarReader); err != nil {
+				return err
+			}
+		} else if strings.HasSuffix(name, ".h") {
+			Log("Found header file in tarball")
+			if err := installFile(dir, filepath.Base(name), tarReader); err != nil {
+				return err
+			}
+		} else if strings.HasSuffix(name, getStaticLibFileName(installArgs.os)) {
+			Log("Found static library in tarball")
+			if err := installFile(dir, filepath.Base(name), tarReader); err != nil {
+				return err
+			}
+		} else if strings.HasSuffix(name, ".pc.in") {
+			if strings.Contains(installArgs.os, "windows") {
+				continue
+			}
+			Log("Found pkg-config files")
+
+			outName := strings.ReplaceAll(filepath.Base(name), ".pc.in", ".pc")
+			data, err := rewritePkgConfig(tarReader, installArgs)
 			if err != nil {
 				return err
 			}
+			if err := installFile(dir, outName, bytes.NewReader(data)); err != nil {
+				return err
+			}
+		} else {
+			Log("File:", name)
+		}
+	}
+	return nil
+}
 
-			Log("Reading tar file")
-			tarReader := tar.NewReader(r)
+// rewritePkgConfig sets the prefix of a pkg-config file to the install prefix
+func rewritePkgConfig(r io.Reader, installArgs *libInstallArgs) ([]byte, error) {
+	var out bytes.Buffer
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 
-			for {
-				item, err := tarReader.Next()
-				if err == io.EOF {
-					break
-				}
+		if strings.HasPrefix(line, "prefix=") {
+			line = "prefix=" + installArgs.prefix + "\n"
+		}
 
-				item.Name = strings.Trim(item.Name, " ")
-
-				if strings.HasSuffix(item.Name, getSharedObjectExt(installArgs.os)) {
-					Log("Found shared object file in tarball")
-					lib := filepath.Join(installArgs.prefix, installArgs.libDir)
-					Log("Creating directory for lib:", lib)
-					os.MkdirAll(lib, 0o755)
-					out, err := os.Create(filepath.Join(lib, item.Name))
-					if err != nil {
-						return err
-					}
-					Print("Copying", item.Name, "to", out.Name())
-					io.Copy(out, tarReader)
-					out.Close()
-				} else if strings.HasSuffix(item.Name, ".h") {
-					Log("Found header file in tarball")
-					include := filepath.Join(installArgs.prefix, installArgs.includeDir)
-					Log("Creating directory for header file:", include)
-					os.MkdirAll(include, 0o755)
-					out, err := os.Create(filepath.Join(include, item.Name))
-					if err != nil {
-						return err
-					}
-
-					Print("Copying", item.Name, "to", out.Name())
-					io.Copy(out, tarReader)
-					out.Close()
-				} else if strings.HasSuffix(item.Name, getStaticLibFileName(installArgs.os)) {
-					Log("Found static library in tarball")
-					lib := filepath.Join(installArgs.prefix, installArgs.libDir)
-					Log("Creating directory for lib:", lib)
-					os.MkdirAll(lib, 0o755)
-					out, err := os.Create(filepath.Join(lib, item.Name))
-					if err != nil {
-						return err
-					}
-
-					Print("Copying", item.Name, "to", out.Name())
-					io.Copy(out, tarReader)
-					out.Close()
-				} else if strings.HasSuffix(item.Name, ".pc.in") {
-					if strings.Contains(installArgs.os, "windows") {
-						continue
-					}
-					Log("Found pkg-config files")
-
-					pkgconfig := filepath.Join(installArgs.prefix, installArgs.libDir, "pkgconfig")
-					Log("Creating directory for pc file:", pkgconfig)
-					os.MkdirAll(pkgconfig, 0o755)
-
-					outName := strings.ReplaceAll(item.Name, ".pc.in", ".pc")
-					out, err := os.Create(filepath.Join(pkgconfig, outName))
-					if err != nil {
-						return err
-					}
-
-					Print("Copying", item.Name, "to", out.Name())
-					r := bufio.NewReader(tarReader)
-					for {
-						line, err := r.ReadString('\n')
-						if err == io.EOF {
-							break
-						}
-						if err != nil {
-							out.Close()
-							return err
-						}
-
-						if strings.HasPrefix(line, "prefix=") {
-							line = "prefix=" + installArgs.prefix + "\n"
-						}
-
-						// Inject `-framework Security` on macOS
-						if installArgs.os == "darwin" && strings.HasPrefix(line, "Libs:") {
-							line = strings.ReplaceAll(line, "Libs: ", "Libs: -framework Security ")
-						}
-
-						io.WriteString(out, line)
-					}
-					out.Close()
-				} else {
-					Log("File:", item.Name)
-				}
-			}
-			return nil
-		} else {
-			Log("Invalid asset:", asset.GetName())
+		// Inject `-framework Security` on macOS
+		if installArgs.os == "darwin" && strings.HasPrefix(line, "Libs:") {
+			line = strings.ReplaceAll(line, "Libs: ", "Libs: -framework Security ")
 		}
 
+		out.WriteString(line)
 	}
-
-	return errors.New("No release asset found matching " + assetName)
+	return out.Bytes(), nil
 }
 
 func runLibUninstall(cmd *cobra.Command, uninstallArgs *libUninstallArgs) error {
 	Log("Uninstalling files from prefix:", uninstallArgs.prefix)
+	version := uninstallArgs.version
+	if version == "" {
+		version = currentLibVersion(&uninstallArgs.libArgs)
+	}
+	if version != "" {
+		if err := validLibVersion(version); err != nil {
+			return err
+		}
+		receipt, err := readInstallReceipt(&uninstallArgs.libArgs, version)
+		if err == nil {
+			return uninstallReceipt(&uninstallArgs.libArgs, receipt, uninstallArgs.dryRun, uninstallArgs.force)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		} else if uninstallArgs.version != "" {
+			return fmt.Errorf("no install receipt found for %s in %s", version, uninstallArgs.prefix)
+		}
+	}
+
+	// Installations without a receipt are removed using the default file names
+	Print("No install receipt found, removing the default libextism files")
+	if uninstallArgs.dryRun {
+		for _, f := range []string{
+			filepath.Join(uninstallArgs.prefix, uninstallArgs.libDir, getSharedObjectFileName(runtime.GOOS)),
+			filepath.Join(uninstallArgs.prefix, uninstallArgs.libDir, getStaticLibFileName(runtime.GOOS)),
+			filepath.Join(uninstallArgs.prefix, uninstallArgs.includeDir, "extism.h"),
+			filepath.Join(uninstallArgs.prefix, uninstallArgs.libDir, "pkgconfig", "extism.pc"),
+			filepath.Join(uninstallArgs.prefix, uninstallArgs.libDir, "pkgconfig", "extism-static.pc"),
+		} {
+			if _, err := os.Lstat(f); err == nil {
+				Print("Would remove", f)
+			}
+		}
+		return nil
+	}
+
 	soFile := filepath.Join(uninstallArgs.prefix, uninstallArgs.libDir, getSharedObjectFileName(runtime.GOOS))
 	Print("Removing", soFile)
 	err := os.Remove(soFile)
@@ -322,48 +516,6 @@ func runLibUninstall(cmd *cobra.Command, uninstallArgs *libUninstallArgs) error
 	return nil
 }
 
-func runLibVersions(cmd *cobra.Command, args []string) error {
-	releases, err := getReleases(cmd.Context())
-	if err != nil {
-		return err
-	}
-
-	Log("Found", len(releases))
-
-	search := map[string]bool{}
-
-	for i := range args {
-		search[args[i]] = true
-	}
-
-	for _, rel := range releases {
-		name := rel.GetTagName()
-		if len(args) > 0 {
-			_, ok := search[name]
-
-			if !ok {
-				continue
-			}
-		}
-		Print(name)
-
-		if len(args) > 0 {
-			for _, asset := range rel.Assets {
-				filename := asset.GetName()
-				if !strings.HasSuffix(filename, ".tar.gz") {
-					continue
-				}
-				triple := strings.TrimSuffix(strings.TrimPrefix(filename, "libextism-"), "-"+name+".tar.gz")
-				triple = strings.TrimSuffix(triple, "-main.tar.gz")
-				Print("\t" + triple)
-
-			}
-		}
-	}
-
-	return nil
-}
-
 func runLibCheck(cmd *cobra.Command, args []string) error {
 	soName := sharedLibraryName(runtime.GOOS)
 	Log("dlopen", soName)
@@ -408,8 +560,13 @@ func LibCmd() *cobra.Command {
 	libInstall.Flags().StringVar(&installArgs.arch, "arch", runtime.GOARCH, "The target architecture: x86_64, aarch64")
 	libInstall.Flags().StringVar(&installArgs.libc, "libc", "", "The libc implementation/compiler to use: gnu, msvc, musl")
 	libInstall.Flags().StringVar(&installArgs.triplet, "triplet", "", "CPU, vendor, and operating system (sometimes incl. libc) combined. Can be used instead of arch, os, and libc fields.")
+	libInstall.Flags().StringVar(&installArgs.from, "from", "", "Install from a local release tarball instead of downloading a release")
+	libInstall.Flags().StringVar(&installArgs.mirror, "mirror", os.Getenv("EXTISM_LIB_MIRROR"),
+		"Base URL of a mirror using the same layout as Github releases, e.g. <mirror>/<version>/<asset>. Can also be set using $EXTISM_LIB_MIRROR")
+	libInstall.Flags().StringVar(&installArgs.sha256, "sha256", "", "The expected sha256 of the release tarball, by default the checksum published with the release is used")
+	libInstall.Flags().BoolVar(&installArgs.skipChecksum, "skip-checksum", false, "Install even if no checksum is published for the release tarball")
 	libInstall.Flags().StringVar(&installArgs.prefix, "prefix", defaultPrefix(runtime.GOOS),
-		"Prefix for libextism installation. libextism will be copied to $prefix/$libdir and extism.h will be copied to $prefix/$includedir")
+		"Prefix for libextism installation. libextism will be installed to $prefix/$libdir/extism/$version and linked to $prefix/$libdir, extism.h will be linked to $prefix/$includedir")
 	libInstall.Flags().StringVar(&installArgs.libDir, "libdir", "lib", "The shared object will be installed to $prefix/$libdir")
 	libInstall.Flags().StringVar(&installArgs.includeDir, "includedir", "include", "The header file will be installed to $prefix/$includedir")
 	lib.AddCommand(libInstall)
@@ -426,17 +583,126 @@ func LibCmd() *cobra.Command {
 		"Prefix for existing libextism installation")
 	libUninstall.Flags().StringVar(&uninstallArgs.libDir, "libdir", "lib", "The shared object will be removed from $prefix/$libdir")
 	libUninstall.Flags().StringVar(&uninstallArgs.includeDir, "includedir", "include", "The header file will be removed from $prefix/$includedir")
+	libUninstall.Flags().StringVar(&uninstallArgs.version, "version", "", "The version to uninstall, defaults to the active version")
+	libUninstall.Flags().BoolVar(&uninstallArgs.dryRun, "dry-run", false, "Print the files that would be removed without removing them")
+	libUninstall.Flags().BoolVar(&uninstallArgs.force, "force", false, "Remove files even if they were modified after they were installed")
 	lib.AddCommand(libUninstall)
 
+	// List
+	listArgs := &libArgs{}
+	libList := &cobra.Command{
+		Use:          "list",
+		Short:        "List installed libextism versions",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibList, listArgs),
+		Args:         cobra.NoArgs,
+	}
+	libList.Flags().StringVar(&listArgs.prefix, "prefix", defaultPrefix(runtime.GOOS), "Prefix for existing libextism installations")
+	libList.Flags().StringVar(&listArgs.libDir, "libdir", "lib", "Versions are installed to $prefix/$libdir/extism")
+	lib.AddCommand(libList)
+
+	// Use
+	useArgs := &libArgs{}
+	libUse := &cobra.Command{
+		Use:          "use <version>",
+		Short:        "Switch the active libextism version",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibUse, useArgs),
+		Args:         cobra.ExactArgs(1),
+	}
+	libUse.Flags().StringVar(&useArgs.prefix, "prefix", defaultPrefix(runtime.GOOS), "Prefix for existing libextism installations")
+	libUse.Flags().StringVar(&useArgs.libDir, "libdir", "lib", "The shared object will be linked to $prefix/$libdir")
+	libUse.Flags().StringVar(&useArgs.includeDir, "includedir", "include", "The header file will be linked to $prefix/$includedir")
+	lib.AddCommand(libUse)
+
 	// Versions
+	versionsArgs := &libVersionsArgs{}
 	libVersions := &cobra.Command{
-		Use:          "versions",
+		Use:          "versions [tag | constraint]...",
 		Short:        "List available Extism versions",
+		Example:      "lib versions\nlib versions '>=1.4 <2'\nlib versions v1.9.1",
 		SilenceUsage: true,
-		RunE:         runLibVersions,
+		RunE:         RunArgs(runLibVersions, versionsArgs),
 	}
+	libVersions.Flags().BoolVar(&versionsArgs.prerelease, "prerelease", false, "Include pre-releases")
+	libVersions.Flags().BoolVar(&versionsArgs.assets, "assets", false, "List the release assets of each version")
+	libVersions.Flags().BoolVar(&versionsArgs.json, "json", false, "Print the versions as JSON")
+	libVersions.Flags().StringVar(&versionsArgs.prefix, "prefix", defaultPrefix(runtime.GOOS), "Prefix used to find installed versions")
+	libVersions.Flags().StringVar(&versionsArgs.libDir, "libdir", "lib", "Installed versions are found in $prefix/$libdir/extism")
 	lib.AddCommand(libVersions)
 
+	// Vendor
+	vendorArgs := &libVendorArgs{}
+	libVendor := &cobra.Command{
+		Use:          "vendor",
+		Short:        "Fetch libextism for several targets into a project directory",
+		Long:         "Fetch libextism for several targets into a project directory. The versions and checksums of the fetched files are written to " + vendorLockFile + ", running without --triplet fetches the files listed in an existing lockfile again.",
+		Example:      "lib vendor --triplet x86_64-unknown-linux-gnu --triplet aarch64-apple-darwin --dir third_party/extism",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibVendor, vendorArgs),
+		Args:         cobra.NoArgs,
+	}
+	libVendor.Flags().StringVar(&vendorArgs.version, "version", "", "libextism version to vendor, defaults to the most recent release")
+	libVendor.Flags().StringArrayVar(&vendorArgs.triplets, "triplet", []string{}, "Target triplet to vendor, may be repeated")
+	libVendor.Flags().StringVar(&vendorArgs.dir, "dir", filepath.Join("third_party", "extism"), "Directory to vendor libextism into")
+	libVendor.Flags().StringVar(&vendorArgs.mirror, "mirror", os.Getenv("EXTISM_LIB_MIRROR"), "Fetch release tarballs from a mirror instead of Github")
+	libVendor.Flags().BoolVar(&vendorArgs.skipChecksum, "skip-checksum", false, "Vendor release tarballs even if no checksum is published for them")
+	lib.AddCommand(libVendor)
+
+	// Call
+	libCallArgs := &libCallArgs{}
+	libCall := &cobra.Command{
+		Use:          "call [flags] [wasm_file] function",
+		Short:        "Call a plugin function using the installed libextism",
+		Long:         "Call a plugin function using the libextism C API instead of the runtime built into the CLI, this can be used to check that a native installation works and to compare it with `extism call`.",
+		Example:      "lib call plugin.wasm count_vowels --input 'hello'\nlib call --lib ~/.local/lib/libextism.so plugin.wasm count_vowels --input 'hello'",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibCall, libCallArgs),
+		Args:         cobra.RangeArgs(1, 2),
+	}
+	libCall.Flags().StringVar(&libCallArgs.lib, "lib", sharedLibraryName(runtime.GOOS), "Path to the libextism shared object, by default it's found using the dynamic loader search path")
+	libCall.Flags().StringVarP(&libCallArgs.input, "input", "i", "", "Input data")
+	libCall.Flags().BoolVar(&libCallArgs.stdin, "stdin", false, "Read input from stdin")
+	libCall.Flags().IntVar(&libCallArgs.loop, "loop", 1, "Number of times to call the function")
+	addManifestFlags(libCall, &libCallArgs.callArgs)
+	libCall.Flags().StringVar(&libCallArgs.logLevel, "log-level", "", "Set the libextism log level: trace, debug, warn, info, error")
+	libCall.MarkFlagsMutuallyExclusive("input", "stdin")
+	lib.AddCommand(libCall)
+
+	// Flags
+	flagsArgs := &libFlagsArgs{}
+	libFlags := &cobra.Command{
+		Use:          "flags",
+		Short:        "Print compiler and linker flags for an installed libextism",
+		Example:      "lib flags --cflags --libs\nlib flags --static --format cmake",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibFlags, flagsArgs),
+		Args:         cobra.NoArgs,
+	}
+	libFlags.Flags().BoolVar(&flagsArgs.cflags, "cflags", false, "Print the compiler flags")
+	libFlags.Flags().BoolVar(&flagsArgs.libs, "libs", false, "Print the linker flags")
+	libFlags.Flags().BoolVar(&flagsArgs.static, "static", false, "Link the static library instead of the shared object")
+	libFlags.Flags().StringVar(&flagsArgs.format, "format", "flags", "Output format: flags, cmake, meson, bazel")
+	libFlags.Flags().StringVar(&flagsArgs.os, "os", runtime.GOOS, "The target OS: linux, darwin, windows")
+	libFlags.Flags().StringVar(&flagsArgs.prefix, "prefix", defaultPrefix(runtime.GOOS), "Prefix for the libextism installation")
+	libFlags.Flags().StringVar(&flagsArgs.libDir, "libdir", "lib", "The shared object is installed to $prefix/$libdir")
+	libFlags.Flags().StringVar(&flagsArgs.includeDir, "includedir", "include", "The header file is installed to $prefix/$includedir")
+	lib.AddCommand(libFlags)
+
+	// Doctor
+	doctorArgs := &libArgs{}
+	libDoctor := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Diagnose problems with a libextism installation",
+		SilenceUsage: true,
+		RunE:         RunArgs(runLibDoctor, doctorArgs),
+		Args:         cobra.NoArgs,
+	}
+	libDoctor.Flags().StringVar(&doctorArgs.prefix, "prefix", defaultPrefix(runtime.GOOS), "Prefix for the libextism installation to check")
+	libDoctor.Flags().StringVar(&doctorArgs.libDir, "libdir", "lib", "The shared object is expected in $prefix/$libdir")
+	libDoctor.Flags().StringVar(&doctorArgs.includeDir, "includedir", "include", "The header file is expected in $prefix/$includedir")
+	lib.AddCommand(libDoctor)
+
 	// Check
 	libCheck := &cobra.Command{
 		Use:          "check",
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/ebitengine/purego"
+	"github.com/spf13/cobra"
+)
+
+// libExtism is the subset of the libextism C API used to run plugins, see
+// `extism.h` for the definitions
+type libExtism struct {
+	path string
+
+	version        func() string
+	logFile        func(filename string, level string) bool
+	pluginNew      func(wasm []byte, wasmSize uint64, functions uintptr, nFunctions uint64, withWasi bool, errmsg **byte) uintptr
+	newErrorFree   func(err *byte)
+	pluginCall     func(plugin uintptr, funcName string, data []byte, dataLen uint64) int32
+	pluginError    func(plugin uintptr) string
+	outputLength   func(plugin uintptr) uint64
+	outputData     func(plugin uintptr) *byte
+	functionExists func(plugin uintptr, funcName string) bool
+	pluginFree     func(plugin uintptr)
+}
+
+// loadLibExtism opens a libextism shared object, path may be a file name
+// that's found using the dynamic loader search path
+func loadLibExtism(path string) (*libExtism, error) {
+	Log("dlopen", path)
+	ptr, err := dlopen(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s: %w", path, err)
+	}
+
+	lib := &libExtism{path: path}
+	symbols := map[string]any{
+		"extism_version":                &lib.version,
+		"extism_log_file":               &lib.logFile,
+		"extism_plugin_new":             &lib.pluginNew,
+		"extism_plugin_new_error_free":  &lib.newErrorFree,
+		"extism_plugin_call":            &lib.pluginCall,
+		"extism_plugin_error":           &lib.pluginError,
+		"extism_plugin_output_length":   &lib.outputLength,
+		"extism_plugin_output_data":     &lib.outputData,
+		"extism_plugin_function_exists": &lib.functionExists,
+		"extism_plugin_free":            &lib.pluginFree,
+	}
+	for name, fptr := range symbols {
+		// RegisterLibFunc panics when a symbol is missing
+		if _, err := dlsym(ptr, name); err != nil {
+			return nil, fmt.Errorf("%s doesn't export %s, it may be too old: %w", path, name, err)
+		}
+		purego.RegisterLibFunc(fptr, ptr, name)
+	}
+	return lib, nil
+}
+
+// cString copies a NUL terminated C string
+func cString(p *byte) string {
+	if p == nil {
+		return ""
+	}
+	buf := []byte{}
+	for ; *p != 0; p = (*byte)(unsafe.Add(unsafe.Pointer(p), 1)) {
+		buf = append(buf, *p)
+	}
+	return string(buf)
+}
+
+// libPlugin is a plugin created using libextism
+type libPlugin struct {
+	lib    *libExtism
+	plugin uintptr
+}
+
+// newPlugin creates a plugin from a JSON encoded manifest, libextism accepts
+// a manifest anywhere a Wasm module is expected
+func (l *libExtism) newPlugin(manifest []byte, wasi bool) (*libPlugin, error) {
+	var errmsg *byte
+	plugin := l.pluginNew(manifest, uint64(len(manifest)), 0, 0, wasi, &errmsg)
+	runtime.KeepAlive(manifest)
+	if plugin == 0 {
+		msg := cString(errmsg)
+		if errmsg != nil {
+			l.newErrorFree(errmsg)
+		}
+		return nil, errors.New(msg)
+	}
+	return &libPlugin{lib: l, plugin: plugin}, nil
+}
+
+func (p *libPlugin) functionExists(funcName string) bool {
+	return p.lib.functionExists(p.plugin, funcName)
+}
+
+// call calls a plugin function, the return code is included with errors
+// returned by the plugin
+func (p *libPlugin) call(funcName string, input []byte) ([]byte, int32, error) {
+	Log("Calling", funcName, "using", p.lib.path)
+	rc := p.lib.pluginCall(p.plugin, funcName, input, uint64(len(input)))
+	runtime.KeepAlive(input)
+	if rc != 0 {
+		msg := p.lib.pluginError(p.plugin)
+		if msg == "" {
+			msg = "unknown error"
+		}
+		return nil, rc, errors.New(msg)
+	}
+
+	// The output is owned by the plugin and only valid until the next call
+	length := p.lib.outputLength(p.plugin)
+	output := []byte{}
+	if length > 0 {
+		output = append(output, unsafe.Slice(p.lib.outputData(p.plugin), length)...)
+	}
+	Log("Call returned", len(output), "bytes")
+	return output, 0, nil
+}
+
+func (p *libPlugin) close() {
+	p.lib.pluginFree(p.plugin)
+}
+
+type libCallArgs struct {
+	callArgs
+	lib string
+}
+
+func runLibCall(cmd *cobra.Command, call *libCallArgs) error {
+	if len(call.args) < 1 {
+		return errors.New("a function name is required")
+	} else if len(call.args) < 2 && len(call.manifests) == 0 {
+		return errors.New("an input file or manifest is required")
+	}
+
+	wasm := ""
+	if len(call.args) > 1 {
+		wasm = call.args[0]
+	}
+	funcName := call.args[len(call.args)-1]
+
+	manifest, err := call.getManifest(wasm)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	lib, err := loadLibExtism(call.lib)
+	if err != nil {
+		return err
+	}
+	Log("Using libextism", lib.version())
+
+	if call.logLevel != "" {
+		lib.logFile("stderr", call.logLevel)
+	}
+
+	Log("Creating plugin")
+	plugin, err := lib.newPlugin(data, call.wasi)
+	if err != nil {
+		return err
+	}
+	defer plugin.close()
+
+	if !plugin.functionExists(funcName) {
+		return fmt.Errorf("function %s does not exist", funcName)
+	}
+
+	input := []byte(call.input)
+	if call.stdin {
+		Log("Reading input from stdin")
+		input = readStdin()
+	}
+	Log("Got", len(input), "bytes of input data")
+
+	for i := 0; i < call.loop; i++ {
+		res, rc, err := plugin.call(funcName, input)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("returned non-zero exit code: %d", rc))
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(res))
+
+		if call.loop > 1 {
+			fmt.Fprintln(cmd.OutOrStdout())
+		}
+	}
+	return nil
+}
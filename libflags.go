@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type libFlagsArgs struct {
+	libArgs
+	os     string
+	cflags bool
+	libs   bool
+	static bool
+	format string
+}
+
+// libFlags describes how to compile and link against an installed libextism
+type libFlags struct {
+	includeDir string
+	libDir     string
+	// library is the path of the shared object or static library
+	library string
+	// system lists the libraries and frameworks libextism depends on
+	system []string
+	static bool
+}
+
+func getLibFlags(a *libFlagsArgs) (libFlags, error) {
+	prefix, err := filepath.Abs(a.prefix)
+	if err != nil {
+		return libFlags{}, err
+	}
+
+	flags := libFlags{
+		includeDir: filepath.Join(prefix, a.includeDir),
+		libDir:     filepath.Join(prefix, a.libDir),
+		static:     a.static,
+	}
+	if a.static {
+		flags.library = filepath.Join(flags.libDir, getStaticLibFileName(a.os))
+	} else {
+		flags.library = filepath.Join(flags.libDir, getSharedObjectFileName(a.os))
+	}
+
+	// Matches the `-framework Security` added to extism.pc by `lib install`
+	if a.os == "darwin" || a.os == "macos" {
+		flags.system = append(flags.system, "-framework", "Security")
+	}
+	if a.static {
+		switch a.os {
+		case "windows":
+			flags.system = append(flags.system, "-lws2_32", "-luserenv", "-lbcrypt", "-lntdll")
+		case "darwin", "macos":
+			flags.system = append(flags.system, "-lm")
+		default:
+			flags.system = append(flags.system, "-lpthread", "-ldl", "-lm")
+		}
+	}
+	return flags, nil
+}
+
+func (f libFlags) cflags() []string {
+	return []string{"-I" + f.includeDir}
+}
+
+func (f libFlags) libs(osName string) []string {
+	if f.static {
+		return append([]string{f.library}, f.system...)
+	}
+	libs := []string{"-L" + f.libDir}
+	if osName != "windows" {
+		libs = append(libs, "-Wl,-rpath,"+f.libDir)
+	}
+	libs = append(libs, "-lextism")
+	return append(libs, f.system...)
+}
+
+func quoteList(items []string) string {
+	quoted := []string{}
+	for _, item := range items {
+		quoted = append(quoted, fmt.Sprintf("%q", item))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func cmakeSnippet(f libFlags) string {
+	kind := "SHARED"
+	if f.static {
+		kind = "STATIC"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "add_library(extism %s IMPORTED)\n", kind)
+	fmt.Fprintf(&b, "set_target_properties(extism PROPERTIES\n")
+	fmt.Fprintf(&b, "  IMPORTED_LOCATION %q\n", filepath.ToSlash(f.library))
+	fmt.Fprintf(&b, "  INTERFACE_INCLUDE_DIRECTORIES %q", filepath.ToSlash(f.includeDir))
+	if len(f.system) > 0 {
+		fmt.Fprintf(&b, "\n  INTERFACE_LINK_LIBRARIES %q", strings.Join(f.system, " "))
+	}
+	fmt.Fprintf(&b, ")\n")
+	return b.String()
+}
+
+func mesonSnippet(f libFlags, osName string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "extism_dep = declare_dependency(\n")
+	fmt.Fprintf(&b, "  compile_args: [%s],\n", strings.ReplaceAll(quoteList(f.cflags()), `"`, `'`))
+	fmt.Fprintf(&b, "  link_args: [%s],\n", strings.ReplaceAll(quoteList(f.libs(osName)), `"`, `'`))
+	fmt.Fprintf(&b, ")\n")
+	return b.String()
+}
+
+func bazelSnippet(f libFlags, prefix string) string {
+	library, _ := filepath.Rel(prefix, f.library)
+	include, _ := filepath.Rel(prefix, f.includeDir)
+	attr := "shared_library"
+	if f.static {
+		attr = "static_library"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "new_local_repository(\n")
+	fmt.Fprintf(&b, "    name = \"extism\",\n")
+	fmt.Fprintf(&b, "    path = %q,\n", filepath.ToSlash(prefix))
+	fmt.Fprintf(&b, "    build_file_content = \"\"\"\n")
+	fmt.Fprintf(&b, "cc_import(\n")
+	fmt.Fprintf(&b, "    name = \"extism\",\n")
+	fmt.Fprintf(&b, "    hdrs = [%q],\n", filepath.ToSlash(filepath.Join(include, "extism.h")))
+	fmt.Fprintf(&b, "    includes = [%q],\n", filepath.ToSlash(include))
+	fmt.Fprintf(&b, "    %s = %q,\n", attr, filepath.ToSlash(library))
+	if len(f.system) > 0 {
+		fmt.Fprintf(&b, "    linkopts = [%s],\n", quoteList(f.system))
+	}
+	fmt.Fprintf(&b, "    visibility = [\"//visibility:public\"],\n")
+	fmt.Fprintf(&b, ")\n")
+	fmt.Fprintf(&b, "\"\"\",\n")
+	fmt.Fprintf(&b, ")\n")
+	return b.String()
+}
+
+func runLibFlags(cmd *cobra.Command, flagsArgs *libFlagsArgs) error {
+	flags, err := getLibFlags(flagsArgs)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	switch flagsArgs.format {
+	case "", "flags":
+		// Print both when neither is selected, like `pkg-config --cflags --libs`
+		all := !flagsArgs.cflags && !flagsArgs.libs
+		var args []string
+		if all || flagsArgs.cflags {
+			args = append(args, flags.cflags()...)
+		}
+		if all || flagsArgs.libs {
+			args = append(args, flags.libs(flagsArgs.os)...)
+		}
+		fmt.Fprintln(out, strings.Join(args, " "))
+	case "cmake":
+		fmt.Fprint(out, cmakeSnippet(flags))
+	case "meson":
+		fmt.Fprint(out, mesonSnippet(flags, flagsArgs.os))
+	case "bazel":
+		prefix, err := filepath.Abs(flagsArgs.prefix)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, bazelSnippet(flags, prefix))
+	default:
+		return fmt.Errorf("unsupported format: '%s'. Supported formats are: flags, cmake, meson, bazel", flagsArgs.format)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Each libextism version is installed to `$prefix/$libdir/extism/<version>`, the
+// files of the active version are linked into `$prefix/$libdir`,
+// `$prefix/$libdir/pkgconfig` and `$prefix/$includedir`
+
+func libVersionsDir(a *libArgs) string {
+	return filepath.Join(a.prefix, a.libDir, "extism")
+}
+
+func libVersionDir(a *libArgs, version string) string {
+	return filepath.Join(libVersionsDir(a), version)
+}
+
+// currentLibVersionFile stores the name of the active version
+func currentLibVersionFile(a *libArgs) string {
+	return filepath.Join(libVersionsDir(a), "current")
+}
+
+func validLibVersion(version string) error {
+	if version == "" || version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		return fmt.Errorf("invalid version: %s", version)
+	}
+	return nil
+}
+
+// tarballVersion returns the version from the name of a release tarball, e.g.
+// `libextism-x86_64-unknown-linux-gnu-v1.9.1.tar.gz`
+func tarballVersion(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), ".tar.gz")
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return ""
+	}
+	version := name[i+1:]
+	if version == "main" {
+		return "latest"
+	}
+	return version
+}
+
+func installedLibVersions(a *libArgs) ([]string, error) {
+	entries, err := os.ReadDir(libVersionsDir(a))
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+func currentLibVersion(a *libArgs) string {
+	data, err := os.ReadFile(currentLibVersionFile(a))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// libLinkPath returns the path an installed file is linked to
+func libLinkPath(a *libArgs, name string) string {
+	if strings.HasSuffix(name, ".h") {
+		return filepath.Join(a.prefix, a.includeDir, name)
+	} else if strings.HasSuffix(name, ".pc") {
+		return filepath.Join(a.prefix, a.libDir, "pkgconfig", name)
+	}
+	return filepath.Join(a.prefix, a.libDir, name)
+}
+
+// linkFile creates a relative symlink, files are copied instead when symlinks
+// aren't supported
+func linkFile(target, link string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(link); err == nil {
+		if fi.IsDir() {
+			return fmt.Errorf("unable to link %s, a directory already exists", link)
+		}
+		if err := os.Remove(link); err != nil {
+			return err
+		}
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		rel = target
+	}
+	Log("Linking", link, "to", rel)
+	if err := os.Symlink(rel, link); err != nil {
+		Log("Unable to create symlink, copying instead:", err)
+		return copyFile(target, link)
+	}
+	return nil
+}
+
+func libVersionFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+// useLibVersion links the files of an installed version into the prefix, links
+// to files of the previous version that don't exist in the new version are
+// removed
+func useLibVersion(a *libArgs, version string) error {
+	if err := validLibVersion(version); err != nil {
+		return err
+	}
+
+	dir := libVersionDir(a, version)
+	files, err := libVersionFiles(dir)
+	if err != nil {
+		installed, _ := installedLibVersions(a)
+		return fmt.Errorf("version %s is not installed in %s, installed versions: %s", version, a.prefix, strings.Join(installed, ", "))
+	}
+
+	if current := currentLibVersion(a); current != "" && current != version {
+		previous, _ := libVersionFiles(libVersionDir(a, current))
+		for _, name := range previous {
+			link := libLinkPath(a, name)
+			if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				Log("Removing", link)
+				os.Remove(link)
+			}
+		}
+	}
+
+	for _, name := range files {
+		if err := linkFile(filepath.Join(dir, name), libLinkPath(a, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(currentLibVersionFile(a), []byte(version+"\n"), 0o644); err != nil {
+		return err
+	}
+	Print("Using libextism", version, "from", dir)
+	return nil
+}
+
+func runLibList(cmd *cobra.Command, listArgs *libArgs) error {
+	versions, err := installedLibVersions(listArgs)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		Print("No versions installed in", listArgs.prefix)
+		return nil
+	}
+
+	current := currentLibVersion(listArgs)
+	for _, version := range versions {
+		if version == current {
+			fmt.Fprintln(cmd.OutOrStdout(), "*", version)
+		} else {
+			fmt.Fprintln(cmd.OutOrStdout(), " ", version)
+		}
+	}
+	return nil
+}
+
+func runLibUse(cmd *cobra.Command, useArgs *libArgs) error {
+	if len(useArgs.args) != 1 {
+		return errors.New("a version is required")
+	}
+
+	version := useArgs.args[0]
+	if _, err := os.Stat(libVersionDir(useArgs, version)); err != nil && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return useLibVersion(useArgs, version)
+}
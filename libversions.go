@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+type libVersionsArgs struct {
+	libArgs
+	prerelease bool
+	assets     bool
+	json       bool
+}
+
+type libVersion struct {
+	Tag        string     `json:"tag"`
+	Published  time.Time  `json:"published"`
+	Prerelease bool       `json:"prerelease"`
+	Installed  bool       `json:"installed"`
+	Active     bool       `json:"active"`
+	Assets     []libAsset `json:"assets"`
+}
+
+type libAsset struct {
+	Name    string `json:"name"`
+	Triplet string `json:"triplet"`
+	Size    int    `json:"size"`
+	Url     string `json:"url"`
+}
+
+var activeVersionStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("170"))
+
+func formatSize(size int) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := unit, 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// releaseTriplet returns the target of a release tarball, e.g.
+// `x86_64-unknown-linux-gnu` for `libextism-x86_64-unknown-linux-gnu-v1.9.1.tar.gz`
+func releaseTriplet(filename, tag string) string {
+	triple := strings.TrimSuffix(strings.TrimPrefix(filename, "libextism-"), "-"+tag+".tar.gz")
+	return strings.TrimSuffix(triple, "-main.tar.gz")
+}
+
+// runLibVersions lists releases, each argument that is a release tag is matched
+// exactly and the remaining arguments are combined into a semver constraint
+func runLibVersions(cmd *cobra.Command, versionsArgs *libVersionsArgs) error {
+	releases, err := getReleases(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	Log("Found", len(releases))
+
+	tags := map[string]bool{}
+	for _, rel := range releases {
+		tags[rel.GetTagName()] = true
+	}
+
+	search := map[string]bool{}
+	ranges := []string{}
+	for _, arg := range versionsArgs.args {
+		if tags[arg] {
+			search[arg] = true
+		} else {
+			ranges = append(ranges, arg)
+		}
+	}
+
+	var constraint *semver.Constraints
+	if len(ranges) > 0 {
+		constraint, err = semver.NewConstraint(strings.Join(ranges, " "))
+		if err != nil {
+			return fmt.Errorf("invalid version constraint: %w", err)
+		}
+		constraint.IncludePrerelease = versionsArgs.prerelease
+	}
+
+	installed := map[string]bool{}
+	if versions, err := installedLibVersions(&versionsArgs.libArgs); err == nil {
+		for _, v := range versions {
+			installed[v] = true
+		}
+	}
+	current := currentLibVersion(&versionsArgs.libArgs)
+
+	versions := []libVersion{}
+	for _, rel := range releases {
+		name := rel.GetTagName()
+		if !search[name] {
+			// Only tags are listed when there's no constraint
+			if len(search) > 0 && constraint == nil {
+				continue
+			}
+			v, err := semver.NewVersion(name)
+			prerelease := rel.GetPrerelease() || (err == nil && v.Prerelease() != "")
+			if prerelease && !versionsArgs.prerelease {
+				continue
+			}
+			if constraint != nil && (err != nil || !constraint.Check(v)) {
+				continue
+			}
+		}
+
+		version := libVersion{
+			Tag:        name,
+			Published:  rel.GetPublishedAt().Time,
+			Prerelease: rel.GetPrerelease(),
+			Installed:  installed[name],
+			Active:     name == current,
+			Assets:     []libAsset{},
+		}
+		for _, asset := range rel.Assets {
+			filename := asset.GetName()
+			if !strings.HasSuffix(filename, ".tar.gz") {
+				continue
+			}
+			version.Assets = append(version.Assets, libAsset{
+				Name:    filename,
+				Triplet: releaseTriplet(filename, name),
+				Size:    asset.GetSize(),
+				Url:     asset.GetBrowserDownloadURL(),
+			})
+		}
+		versions = append(versions, version)
+	}
+
+	out := cmd.OutOrStdout()
+	if versionsArgs.json {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(versions)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, v := range versions {
+		published := ""
+		if !v.Published.IsZero() {
+			published = v.Published.Format(time.DateOnly)
+		}
+		status := ""
+		if v.Active {
+			status = activeVersionStyle.Render("* active")
+		} else if v.Installed {
+			status = "installed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", v.Tag, published, status)
+
+		if search[v.Tag] || versionsArgs.assets {
+			for _, asset := range v.Assets {
+				fmt.Fprintf(w, "\t%s\t%s\n", asset.Triplet, formatSize(asset.Size))
+			}
+		}
+	}
+	return w.Flush()
+}
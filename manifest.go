@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	extism "github.com/extism/go-sdk"
+	"gopkg.in/yaml.v3"
+)
+
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// fileFormat returns the format of a file using its extension: yaml, toml or
+// json, which is the default
+func fileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// decodeFile reads a JSON, YAML or TOML file into a generic map, the format is
+// detected using the file extension
+func decodeFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]any{}
+	switch fileFormat(path) {
+	case "yaml":
+		Log("Parsing as YAML:", path)
+		err = yaml.Unmarshal(data, &m)
+	case "toml":
+		Log("Parsing as TOML:", path)
+		err = toml.Unmarshal(data, &m)
+	default:
+		Log("Parsing as JSON:", path)
+		err = json.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// expandEnv replaces `${VAR}` and `${VAR:-default}` in all string values with
+// the value of the matching environment variable
+func expandEnv(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		var err error
+		s := envVarPattern.ReplaceAllStringFunc(v, func(s string) string {
+			match := envVarPattern.FindStringSubmatch(s)
+			value, ok := os.LookupEnv(match[1])
+			if ok {
+				return value
+			}
+			if match[2] != "" {
+				return match[3]
+			}
+			err = errors.Join(err, fmt.Errorf("environment variable %s is not set", match[1]))
+			return s
+		})
+		return s, err
+	case map[string]any:
+		for k, x := range v {
+			expanded, err := expandEnv(x)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = expanded
+		}
+		return v, nil
+	case []any:
+		for i, x := range v {
+			expanded, err := expandEnv(x)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	case []map[string]any:
+		for i, x := range v {
+			expanded, err := expandEnv(x)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded.(map[string]any)
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// mergeManifest merges src into dst: objects are merged recursively and any
+// other value, including arrays, replaces the existing value
+func mergeManifest(dst, src map[string]any) map[string]any {
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]any)
+		dstMap, dstOk := dst[k].(map[string]any)
+		if srcOk && dstOk {
+			dst[k] = mergeManifest(dstMap, srcMap)
+		} else {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// stringifyConfig converts scalar config values to strings, YAML and TOML
+// decode values such as `port: 8080` or `debug: true` as numbers and booleans
+// but config values are always strings
+func stringifyConfig(manifest map[string]any) error {
+	config, ok := manifest["config"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	for k, v := range config {
+		switch v := v.(type) {
+		case string:
+		case nil:
+			config[k] = ""
+		case map[string]any, []any, []map[string]any:
+			return fmt.Errorf("invalid manifest: config value %s must be a string, number or boolean", k)
+		default:
+			config[k] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// loadManifests reads and merges a list of manifests, later manifests take
+// precedence over earlier ones
+func loadManifests(paths []string) (extism.Manifest, error) {
+	var manifest extism.Manifest
+	merged := map[string]any{}
+	for _, path := range paths {
+		Log("Reading from manifest:", path)
+		m, err := decodeFile(path)
+		if err != nil {
+			return manifest, err
+		}
+
+		// JSON manifests are used as-is, like before YAML and TOML were
+		// supported
+		if fileFormat(path) != "json" {
+			if _, err := expandEnv(m); err != nil {
+				return manifest, fmt.Errorf("invalid manifest %s: %w", path, err)
+			}
+		}
+
+		merged = mergeManifest(merged, m)
+	}
+
+	if err := stringifyConfig(merged); err != nil {
+		return manifest, err
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return manifest, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, err
+	}
+
+	Log("Read manifest:", manifest)
+	return manifest, nil
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// pipelineStage describes a single plugin function in a pipeline, the output of
+// each stage is used as the input to the next one
+type pipelineStage struct {
+	Name         string            `json:"name,omitempty"`
+	Wasm         string            `json:"wasm,omitempty"`
+	Manifest     []string          `json:"manifest,omitempty"`
+	Function     string            `json:"function"`
+	Config       map[string]string `json:"config,omitempty"`
+	Wasi         bool              `json:"wasi,omitempty"`
+	AllowedHosts []string          `json:"allowed_hosts,omitempty"`
+	AllowedPaths map[string]string `json:"allowed_paths,omitempty"`
+	Link         []string          `json:"link,omitempty"`
+	Schema       string            `json:"schema,omitempty"`
+}
+
+type pipelineSpec struct {
+	Stages []pipelineStage `json:"stages"`
+}
+
+type pipelineInstance struct {
+	name     string
+	function string
+	plugin   *extism.Plugin
+	schema   *xtpSchema
+}
+
+func stageName(wasm, funcName string) string {
+	if wasm == "" {
+		return funcName
+	}
+	return wasm + ":" + funcName
+}
+
+// getThenStages parses `--then` arguments in WASM_FILE:FUNCTION format
+func (a *callArgs) getThenStages() ([]pipelineStage, error) {
+	stages := []pipelineStage{}
+	for _, then := range a.then {
+		i := strings.LastIndex(then, ":")
+		if i <= 0 || i == len(then)-1 {
+			return nil, fmt.Errorf("invalid value for --then flag: %s, expected WASM_FILE:FUNCTION", then)
+		}
+		stages = append(stages, pipelineStage{Wasm: then[:i], Function: then[i+1:]})
+	}
+	return stages, nil
+}
+
+// args returns the options for a stage, stages inherit all options from the
+// base command except `--manifest`, which only applies to the base input file
+func (s *pipelineStage) args(base *callArgs) *callArgs {
+	args := *base
+	if s.Wasm != "" {
+		args.manifest = false
+	}
+	args.manifests = s.Manifest
+	args.wasi = base.wasi || s.Wasi
+	args.allowedHosts = append(append([]string{}, base.allowedHosts...), s.AllowedHosts...)
+	args.allowedPaths = append([]string{}, base.allowedPaths...)
+	for host, guest := range s.AllowedPaths {
+		args.allowedPaths = append(args.allowedPaths, host+":"+guest)
+	}
+	args.config = append([]string{}, base.config...)
+	for k, v := range s.Config {
+		args.config = append(args.config, k+"="+v)
+	}
+	args.link = append(append([]string{}, base.link...), s.Link...)
+	return &args
+}
+
+// newPipeline creates a plugin for each stage, offset is the number of stages
+// that come before them so errors use the same stage numbers as runPipeline
+func newPipeline(ctx context.Context, base *callArgs, stages []pipelineStage, logger *pluginLogger, offset int) ([]pipelineInstance, error) {
+	// Stages share the WASI stdio files of the base command, so they're only
+	// opened once and closed with the base
+	if base.files == nil {
+		base.files = map[string]*os.File{}
+	}
+	instances := []pipelineInstance{}
+	for i, stage := range stages {
+		name := stage.Name
+		if name == "" {
+			name = stageName(stage.Wasm, stage.Function)
+		}
+		if stage.Function == "" {
+			closePipeline(instances)
+			return nil, fmt.Errorf("stage %d (%s): a function name is required", offset+i+1, name)
+		}
+
+		args := stage.args(base)
+		manifest, err := args.getManifest(stage.Wasm)
+		if err == nil {
+			Log("Creating plugin for stage", name)
+			var plugin *extism.Plugin
+			plugin, err = args.newPlugin(ctx, manifest)
+			if err == nil {
+				plugin.SetLogger(logger.log)
+				instance := pipelineInstance{name: name, function: stage.Function, plugin: plugin}
+				if stage.Schema != "" {
+					instance.schema, err = loadSchema(stage.Schema)
+				}
+				instances = append(instances, instance)
+				if err == nil {
+					continue
+				}
+			}
+		}
+		closePipeline(instances)
+		return nil, fmt.Errorf("stage %d (%s): %w", offset+i+1, name, err)
+	}
+	return instances, nil
+}
+
+// call calls the stage function, validating the input and output when the
+// stage has a schema
+func (stage *pipelineInstance) call(ctx context.Context, input []byte) ([]byte, error) {
+	if stage.schema != nil {
+		if err := stage.schema.validateInput(stage.function, input); err != nil {
+			return nil, err
+		}
+	}
+	output, err := callFunction(ctx, stage.plugin, stage.function, input)
+	if err != nil {
+		return nil, err
+	}
+	if stage.schema != nil {
+		if err := stage.schema.validateOutput(stage.function, output); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+func closePipeline(stages []pipelineInstance) {
+	for _, stage := range stages {
+		stage.plugin.Close()
+	}
+}
+
+// runPipeline calls each stage in order, errors identify the failing stage when
+// there is more than one stage
+func runPipeline(ctx context.Context, stages []pipelineInstance, input []byte) ([]byte, error) {
+	for i, stage := range stages {
+		output, err := stage.call(ctx, input)
+		if err != nil {
+			if len(stages) == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("stage %d (%s) failed: %w", i+1, stage.name, err)
+		}
+		input = output
+	}
+	return input, nil
+}
+
+func loadPipelineSpec(path string) (pipelineSpec, error) {
+	var spec pipelineSpec
+	m, err := decodeFile(path)
+	if err != nil {
+		return spec, err
+	}
+	if _, err := expandEnv(m); err != nil {
+		return spec, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	if len(spec.Stages) == 0 {
+		return spec, fmt.Errorf("invalid pipeline %s: no stages defined", path)
+	}
+	return spec, nil
+}
+
+func runPipe(cmd *cobra.Command, pipe *callArgs) error {
+	if len(pipe.args) < 1 {
+		return errors.New("a pipeline spec is required")
+	}
+
+	ctx := context.Background()
+	spec, err := loadPipelineSpec(pipe.args[0])
+	if err != nil {
+		return err
+	}
+
+	extism.SetLogLevel(parseLogLevel(pipe.logLevel))
+	logger, err := newPluginLogger(pipe.logFormat, pipe.logFile)
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
+	stages, err := newPipeline(ctx, pipe, spec.Stages, logger, 0)
+	if err != nil {
+		return err
+	}
+	defer closePipeline(stages)
+	defer pipe.closeFiles()
+
+	input := []byte(pipe.input)
+	if pipe.stdin {
+		Log("Reading input from stdin")
+		input = readStdin()
+	}
+
+	for i := 0; i < pipe.loop; i++ {
+		logger.call = i
+		res, err := runPipeline(ctx, stages, input)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(res))
+
+		if pipe.loop > 1 {
+			fmt.Fprintln(cmd.OutOrStdout())
+		}
+	}
+	return nil
+}
+
+func PipeCmd() *cobra.Command {
+	pipe := &callArgs{}
+	cmd := &cobra.Command{
+		Use:          "pipe [flags] spec_file",
+		Short:        "Call a pipeline of plugin functions, passing the output of each stage to the next",
+		SilenceUsage: true,
+		RunE:         RunArgs(runPipe, pipe),
+		Args:         cobra.ExactArgs(1),
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&pipe.input, "input", "i", "", "Input data")
+	flags.BoolVar(&pipe.stdin, "stdin", false, "Read input from stdin")
+	flags.IntVar(&pipe.loop, "loop", 1, "Number of times to call the pipeline")
+	addPluginFlags(cmd, pipe)
+	cmd.MarkFlagsMutuallyExclusive("input", "stdin")
+	return cmd
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	extism "github.com/extism/go-sdk"
+)
+
+// pluginLogger receives log messages emitted by plugins and writes them
+// separately from CLI output
+type pluginLogger struct {
+	lock   sync.Mutex
+	w      io.Writer
+	file   *os.File
+	format string
+
+	// call is the index of the current call, incremented by the caller
+	call int
+}
+
+type pluginLogRecord struct {
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	Call      int       `json:"call"`
+}
+
+func newPluginLogger(format, path string) (*pluginLogger, error) {
+	switch format {
+	case "":
+		format = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("invalid log format: %s, expected text or json", format)
+	}
+
+	logger := &pluginLogger{w: os.Stderr, format: format}
+	if path != "" {
+		Log("Writing plugin logs to", path)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		logger.w = f
+		logger.file = f
+	}
+	return logger, nil
+}
+
+func (l *pluginLogger) log(level extism.LogLevel, message string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	record := pluginLogRecord{
+		Level:     strings.ToLower(level.String()),
+		Message:   message,
+		Timestamp: time.Now().UTC(),
+		Call:      l.call,
+	}
+
+	if l.format == "json" {
+		json.NewEncoder(l.w).Encode(record)
+		return
+	}
+
+	fmt.Fprintf(l.w, "%s %-5s [call %d] %s\n", record.Timestamp.Format(time.RFC3339Nano), level.String(), record.Call, record.Message)
+}
+
+func (l *pluginLogger) Close() error {
+	if l.file != nil {
+		return l.file.Close()
+	}
+	return nil
+}
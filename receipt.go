@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// installReceipt records the files installed for a libextism version, it's
+// stored next to the version directory as `$prefix/$libdir/extism/<version>.json`
+type installReceipt struct {
+	Version   string        `json:"version"`
+	Triplet   string        `json:"triplet,omitempty"`
+	Source    string        `json:"source,omitempty"`
+	Installed time.Time     `json:"installed"`
+	Files     []receiptFile `json:"files"`
+}
+
+type receiptFile struct {
+	// Path is relative to the install prefix
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+}
+
+func installReceiptPath(a *libArgs, version string) string {
+	return libVersionDir(a, version) + ".json"
+}
+
+// writeInstallReceipt records all files in the directory of an installed
+// version
+func writeInstallReceipt(a *libArgs, version, triplet, source string) error {
+	dir := libVersionDir(a, version)
+	files, err := libVersionFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	receipt := installReceipt{Version: version, Triplet: triplet, Source: source, Installed: time.Now().UTC(), Files: []receiptFile{}}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(a.prefix, path)
+		if err != nil {
+			return err
+		}
+		receipt.Files = append(receipt.Files, receiptFile{Path: filepath.ToSlash(rel), Sha256: sha256Hex(data)})
+	}
+
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return err
+	}
+	Log("Writing install receipt", installReceiptPath(a, version))
+	return writeFileAtomic(installReceiptPath(a, version), data, 0o644)
+}
+
+func readInstallReceipt(a *libArgs, version string) (*installReceipt, error) {
+	data, err := os.ReadFile(installReceiptPath(a, version))
+	if err != nil {
+		return nil, err
+	}
+	var receipt installReceipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, fmt.Errorf("invalid install receipt %s: %w", installReceiptPath(a, version), err)
+	}
+	return &receipt, nil
+}
+
+// isLinkTo returns true if link is a symlink to target, or a copy of it when
+// symlinks aren't supported
+func isLinkTo(link, target, hash string) bool {
+	fi, err := os.Lstat(link)
+	if err != nil {
+		return false
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		linkInfo, err := os.Stat(link)
+		if err != nil {
+			return false
+		}
+		targetInfo, err := os.Stat(target)
+		return err == nil && os.SameFile(linkInfo, targetInfo)
+	}
+	data, err := os.ReadFile(link)
+	return err == nil && sha256Hex(data) == hash
+}
+
+// uninstallReceipt removes the files listed in a receipt, nothing is removed
+// if any of the files were modified since they were installed unless force is
+// set
+func uninstallReceipt(a *libArgs, receipt *installReceipt, dryRun, force bool) error {
+	var modified []string
+	for _, f := range receipt.Files {
+		path := filepath.Join(a.prefix, filepath.FromSlash(f.Path))
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if sha256Hex(data) != f.Sha256 {
+			modified = append(modified, path)
+		}
+	}
+	if len(modified) > 0 {
+		if !force {
+			return fmt.Errorf("files were modified after they were installed, use --force to remove them anyway:\n  %s", strings.Join(modified, "\n  "))
+		}
+		Print("Removing modified files:", strings.Join(modified, ", "))
+	}
+
+	remove := func(path string) {
+		if dryRun {
+			Print("Would remove", path)
+			return
+		}
+		Print("Removing", path)
+		if err := os.Remove(path); err != nil {
+			Print(err)
+		}
+	}
+
+	current := currentLibVersion(a) == receipt.Version
+	if current {
+		for _, f := range receipt.Files {
+			path := filepath.Join(a.prefix, filepath.FromSlash(f.Path))
+			link := libLinkPath(a, filepath.Base(path))
+			if isLinkTo(link, path, f.Sha256) {
+				remove(link)
+			}
+		}
+		remove(currentLibVersionFile(a))
+	}
+
+	for _, f := range receipt.Files {
+		path := filepath.Join(a.prefix, filepath.FromSlash(f.Path))
+		if _, err := os.Lstat(path); err == nil {
+			remove(path)
+		}
+	}
+	remove(libVersionDir(a, receipt.Version))
+	remove(installReceiptPath(a, receipt.Version))
+
+	if current && !dryRun {
+		if versions, _ := installedLibVersions(a); len(versions) > 0 {
+			Print("Use `extism lib use` to switch to one of the installed versions:", strings.Join(versions, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// defaultReleasesTTL is how long release metadata is cached, it can be
+// overridden using $EXTISM_RELEASES_TTL
+const defaultReleasesTTL = time.Hour
+
+// releaseSource lists the available releases of libextism or the CLI
+type releaseSource interface {
+	// name identifies the source in logs and in the release cache
+	name() string
+	releases(ctx context.Context) ([]*github.RepositoryRelease, error)
+}
+
+// githubReleaseSource lists releases of a repository using the Github API
+type githubReleaseSource struct {
+	client *github.Client
+	owner  string
+	repo   string
+}
+
+func (s *githubReleaseSource) name() string {
+	return "github.com/" + s.owner + "/" + s.repo
+}
+
+func (s *githubReleaseSource) releases(ctx context.Context) ([]*github.RepositoryRelease, error) {
+	all := []*github.RepositoryRelease{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		releases, res, err := s.client.Repositories.ListReleases(ctx, s.owner, s.repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, releases...)
+		if res.NextPage == 0 {
+			return all, nil
+		}
+		Log("Fetching page", res.NextPage, "of releases")
+		opts.Page = res.NextPage
+	}
+}
+
+// jsonReleaseSource reads releases from a file or URL containing a list of
+// releases in the same format as the Github API
+type jsonReleaseSource struct {
+	url string
+}
+
+func (s *jsonReleaseSource) name() string {
+	return s.url
+}
+
+func (s *jsonReleaseSource) releases(ctx context.Context) ([]*github.RepositoryRelease, error) {
+	var data []byte
+	var err error
+	if isRemote(s.url) {
+		data, err = downloadAsset(ctx, s.url)
+	} else {
+		data, err = os.ReadFile(strings.TrimPrefix(s.url, "file://"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	releases := []*github.RepositoryRelease{}
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("invalid release list %s: %w", s.url, err)
+	}
+	return releases, nil
+}
+
+func newGithubReleaseSource(owner, repo string) *githubReleaseSource {
+	client := github.NewClient(nil)
+	if GithubToken != "" {
+		client = client.WithAuthToken(GithubToken)
+	}
+	return &githubReleaseSource{client: client, owner: owner, repo: repo}
+}
+
+// newReleaseSource returns the Github API source for libextism, or a JSON
+// release list when $EXTISM_RELEASES_URL is set
+func newReleaseSource() releaseSource {
+	if url := os.Getenv("EXTISM_RELEASES_URL"); url != "" {
+		return &jsonReleaseSource{url: url}
+	}
+	return newGithubReleaseSource("extism", "extism")
+}
+
+// newCliReleaseSource returns the Github API source for the CLI, or a JSON
+// release list when $EXTISM_CLI_RELEASES_URL is set
+func newCliReleaseSource() releaseSource {
+	if url := os.Getenv("EXTISM_CLI_RELEASES_URL"); url != "" {
+		return &jsonReleaseSource{url: url}
+	}
+	return newGithubReleaseSource("extism", "cli")
+}
+
+type releaseCacheEntry struct {
+	Source   string                      `json:"source"`
+	Fetched  time.Time                   `json:"fetched"`
+	Releases []*github.RepositoryRelease `json:"releases"`
+}
+
+func releasesTTL() time.Duration {
+	if s := os.Getenv("EXTISM_RELEASES_TTL"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err == nil {
+			return ttl
+		}
+		Log("Ignoring invalid EXTISM_RELEASES_TTL:", err)
+	}
+	return defaultReleasesTTL
+}
+
+func releaseCachePath(source releaseSource) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "releases", sha256Hex([]byte(source.name()))[:16]+".json"), nil
+}
+
+func readReleaseCache(path string) (*releaseCacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry releaseCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// cachedReleases returns the releases from source, release metadata is cached
+// on disk and reused until it expires. Expired metadata is used when the
+// source is unavailable.
+func cachedReleases(ctx context.Context, source releaseSource) ([]*github.RepositoryRelease, error) {
+	ttl := releasesTTL()
+	path, err := releaseCachePath(source)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, cacheErr := readReleaseCache(path)
+	if cacheErr == nil && cached.Source == source.name() && time.Since(cached.Fetched) < ttl {
+		Log("Using releases cached at", cached.Fetched.Format(time.RFC3339))
+		return cached.Releases, nil
+	}
+
+	Log("Fetching releases from", source.name())
+	releases, err := source.releases(ctx)
+	if err != nil {
+		if cacheErr == nil && cached.Source == source.name() {
+			Log("Unable to fetch releases, using releases cached at", cached.Fetched.Format(time.RFC3339)+":", err)
+			return cached.Releases, nil
+		}
+		return nil, err
+	}
+
+	if ttl > 0 {
+		data, err := json.Marshal(releaseCacheEntry{Source: source.name(), Fetched: time.Now().UTC(), Releases: releases})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(path, data, 0o644); err != nil {
+			Log("Unable to cache releases:", err)
+		}
+	}
+	return releases, nil
+}
@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	extism "github.com/extism/go-sdk"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+type replArgs struct {
+	callArgs
+	history string
+}
+
+type repl struct {
+	args     *replArgs
+	ctx      context.Context
+	manifest extism.Manifest
+	plugin   *extism.Plugin
+	logger   *pluginLogger
+	out      io.Writer
+}
+
+var replCommands = []prompt.Suggest{
+	{Text: "call", Description: "Call an exported function: call FUNCTION [INPUT]"},
+	{Text: "functions", Description: "List exported functions"},
+	{Text: "config", Description: "Show config, or: config set KEY VALUE, config unset KEY, config clear"},
+	{Text: "vars", Description: "Show plugin vars, or the value of a single var: vars [KEY]"},
+	{Text: "reset", Description: "Create a new plugin instance"},
+	{Text: "log-level", Description: "Show or set the log level: trace, debug, info, warn, error"},
+	{Text: "help", Description: "Show available commands"},
+	{Text: "exit", Description: "Exit the REPL"},
+}
+
+var logLevels = []string{"trace", "debug", "info", "warn", "error"}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".extism_history")
+}
+
+func (r *repl) load() error {
+	plugin, err := r.args.newPlugin(r.ctx, r.manifest)
+	if err != nil {
+		return err
+	}
+	if r.plugin != nil {
+		r.plugin.Close()
+	}
+	plugin.SetLogger(r.logger.log)
+	r.plugin = plugin
+	return nil
+}
+
+func (r *repl) functions() []string {
+	names := []string{}
+	for name := range r.plugin.Main.ExportedFunctions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// exec runs a single line of REPL input, it returns true when the REPL should exit
+func (r *repl) exec(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return false, nil
+	}
+
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch name {
+	case "exit", "quit":
+		return true, nil
+	case "help":
+		for _, c := range replCommands {
+			fmt.Fprintf(r.out, "%-10s %s\n", c.Text, c.Description)
+		}
+	case "call":
+		funcName, input, _ := strings.Cut(rest, " ")
+		if funcName == "" {
+			return false, errors.New("a function name is required")
+		}
+		res, err := callFunction(r.ctx, r.plugin, funcName, []byte(strings.TrimSpace(input)))
+		if err != nil {
+			return false, err
+		}
+		r.logger.call++
+		fmt.Fprintln(r.out, string(res))
+	case "functions":
+		for _, f := range r.functions() {
+			fmt.Fprintln(r.out, f)
+		}
+	case "config":
+		op, args, _ := strings.Cut(rest, " ")
+		switch op {
+		case "":
+			for _, k := range sortedKeys(r.manifest.Config) {
+				fmt.Fprintf(r.out, "%s=%s\n", k, r.manifest.Config[k])
+			}
+		case "set":
+			key, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+			if key == "" {
+				return false, errors.New("usage: config set KEY VALUE")
+			}
+			r.manifest.Config[key] = strings.TrimSpace(value)
+		case "unset":
+			if args == "" {
+				return false, errors.New("usage: config unset KEY")
+			}
+			delete(r.manifest.Config, strings.TrimSpace(args))
+		case "clear":
+			r.manifest.Config = map[string]string{}
+		default:
+			return false, fmt.Errorf("unknown config command: %s", op)
+		}
+		r.plugin.Config = r.manifest.Config
+	case "vars":
+		if rest != "" {
+			v, ok := r.plugin.Var[rest]
+			if !ok {
+				return false, fmt.Errorf("var not found: %s", rest)
+			}
+			fmt.Fprintln(r.out, string(v))
+			break
+		}
+		for _, k := range sortedKeys(r.plugin.Var) {
+			fmt.Fprintf(r.out, "%s (%d bytes)\n", k, len(r.plugin.Var[k]))
+		}
+	case "reset":
+		if err := r.load(); err != nil {
+			return false, err
+		}
+		Print("Plugin reset")
+	case "log-level":
+		if rest == "" {
+			level := r.args.logLevel
+			if level == "" {
+				level = "error"
+			}
+			fmt.Fprintln(r.out, level)
+			break
+		}
+		valid := false
+		for _, l := range logLevels {
+			if l == rest {
+				valid = true
+			}
+		}
+		if !valid {
+			return false, fmt.Errorf("invalid log level: %s", rest)
+		}
+		r.args.logLevel = rest
+		extism.SetLogLevel(parseLogLevel(rest))
+	default:
+		return false, fmt.Errorf("unknown command: %s, use `help` to list available commands", name)
+	}
+
+	return false, nil
+}
+
+func (r *repl) complete(d prompt.Document) []prompt.Suggest {
+	before := d.TextBeforeCursor()
+	words := strings.Fields(before)
+	if len(words) == 0 || (len(words) == 1 && !strings.HasSuffix(before, " ")) {
+		return prompt.FilterHasPrefix(replCommands, d.GetWordBeforeCursor(), true)
+	}
+
+	var suggestions []prompt.Suggest
+	switch words[0] {
+	case "call":
+		if len(words) > 2 || (len(words) == 2 && strings.HasSuffix(before, " ")) {
+			return nil
+		}
+		for _, f := range r.functions() {
+			suggestions = append(suggestions, prompt.Suggest{Text: f})
+		}
+	case "config":
+		if len(words) == 1 || (len(words) == 2 && !strings.HasSuffix(before, " ")) {
+			suggestions = []prompt.Suggest{{Text: "set"}, {Text: "unset"}, {Text: "clear"}}
+		} else if words[1] == "set" || words[1] == "unset" {
+			for _, k := range sortedKeys(r.manifest.Config) {
+				suggestions = append(suggestions, prompt.Suggest{Text: k})
+			}
+		}
+	case "vars":
+		for _, k := range sortedKeys(r.plugin.Var) {
+			suggestions = append(suggestions, prompt.Suggest{Text: k})
+		}
+	case "log-level":
+		for _, l := range logLevels {
+			suggestions = append(suggestions, prompt.Suggest{Text: l})
+		}
+	}
+	return prompt.FilterHasPrefix(suggestions, d.GetWordBeforeCursor(), true)
+}
+
+func readHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func appendHistory(path, line string) {
+	if path == "" || strings.TrimSpace(line) == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		Log("Unable to write history file:", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func runRepl(cmd *cobra.Command, args *replArgs) error {
+	if len(args.args) < 1 && len(args.manifests) == 0 {
+		return errors.New("an input file or manifest is required")
+	}
+
+	r := &repl{
+		args: args,
+		ctx:  context.Background(),
+		out:  cmd.OutOrStdout(),
+	}
+
+	var err error
+	r.logger, err = newPluginLogger(args.logFormat, args.logFile)
+	if err != nil {
+		return err
+	}
+	defer r.logger.Close()
+
+	wasm := ""
+	if len(args.args) > 0 {
+		wasm = args.args[0]
+	}
+	r.manifest, err = args.getManifest(wasm)
+	if err != nil {
+		return err
+	}
+	extism.SetLogLevel(parseLogLevel(args.logLevel))
+	if err := r.load(); err != nil {
+		return err
+	}
+	// reset replaces r.plugin, so the plugin that is current on exit is closed
+	defer func() { r.plugin.Close() }()
+	defer args.closeFiles()
+
+	// Read commands line by line when input isn't coming from a terminal, this
+	// allows the REPL to be scripted
+	in := cmd.InOrStdin()
+	if f, ok := in.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			exit, err := r.exec(scanner.Text())
+			if err != nil {
+				return err
+			}
+			if exit {
+				break
+			}
+		}
+		return scanner.Err()
+	}
+
+	exit := false
+	p := prompt.New(
+		func(line string) {
+			appendHistory(args.history, line)
+			var err error
+			exit, err = r.exec(line)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Error:", err)
+			}
+		},
+		r.complete,
+		prompt.OptionPrefix("extism> "),
+		prompt.OptionTitle("extism repl"),
+		prompt.OptionHistory(readHistory(args.history)),
+		prompt.OptionSetExitCheckerOnInput(func(string, bool) bool { return exit }),
+	)
+	p.Run()
+	return nil
+}
+
+func ReplCmd() *cobra.Command {
+	args := &replArgs{}
+	cmd := &cobra.Command{
+		Use:          "repl [flags] [wasm_file]",
+		Short:        "Load a plugin and call its functions interactively",
+		SilenceUsage: true,
+		RunE:         RunArgs(runRepl, args),
+		Args:         cobra.MaximumNArgs(1),
+	}
+	addPluginFlags(cmd, &args.callArgs)
+	cmd.Flags().StringVar(&args.history, "history", defaultHistoryFile(), "Path to the REPL history file, an empty string disables history")
+	return cmd
+}
@@ -0,0 +1,322 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// xtpSchema validates plugin input and output using the export types declared
+// in an XTP schema (https://docs.xtp.dylibso.com/docs/concepts/xtp-schema).
+// The same type descriptions are accepted using JSON Schema keywords, refs are
+// resolved as JSON pointers within the schema document.
+//
+// Object properties are required unless they are marked `nullable`, or when an
+// object lists its `required` properties explicitly.
+type xtpSchema struct {
+	root    map[string]any
+	exports map[string]map[string]any
+}
+
+func loadSchema(path string) (*xtpSchema, error) {
+	root, err := decodeFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &xtpSchema{root: root, exports: map[string]map[string]any{}}
+	switch exports := root["exports"].(type) {
+	case map[string]any:
+		for name, e := range exports {
+			export, _ := e.(map[string]any)
+			s.exports[name] = export
+		}
+	case []any:
+		// v0 schemas list exports by name
+		for _, e := range exports {
+			export, _ := e.(map[string]any)
+			name, _ := export["name"].(string)
+			if name != "" {
+				s.exports[name] = export
+			}
+		}
+	case nil:
+		return nil, fmt.Errorf("invalid schema %s: no exports defined", path)
+	default:
+		return nil, fmt.Errorf("invalid schema %s: exports should be a map or a list", path)
+	}
+	return s, nil
+}
+
+// validateInput checks the input data of an export against the schema
+func (s *xtpSchema) validateInput(funcName string, data []byte) error {
+	return s.validateData(funcName, "input", data)
+}
+
+// validateOutput checks the output data of an export against the schema
+func (s *xtpSchema) validateOutput(funcName string, data []byte) error {
+	return s.validateData(funcName, "output", data)
+}
+
+func (s *xtpSchema) validateData(funcName, kind string, data []byte) error {
+	export, ok := s.exports[funcName]
+	if !ok {
+		return fmt.Errorf("function %s is not declared in schema", funcName)
+	}
+
+	schema, ok := export[kind].(map[string]any)
+	if !ok {
+		Log("No", kind, "declared for", funcName, "skipping validation")
+		return nil
+	}
+
+	var errs []string
+	contentType, _ := schema["contentType"].(string)
+	typ, _ := schema["type"].(string)
+	if strings.HasPrefix(contentType, "application/json") || (contentType == "" && typ != "string" && typ != "buffer") {
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		var value any
+		if err := d.Decode(&value); err != nil {
+			return fmt.Errorf("%s for %s is not valid JSON: %w", kind, funcName, err)
+		}
+		errs = s.validate("$", schema, value)
+	} else if typ == "string" && !utf8.Valid(data) {
+		errs = []string{"$: expected a UTF-8 string"}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s for %s does not match schema:\n  %s", kind, funcName, strings.Join(errs, "\n  "))
+	}
+	Log("Validated", kind, "for", funcName)
+	return nil
+}
+
+// resolve follows a `$ref` JSON pointer, e.g. `#/components/schemas/Name`
+func (s *xtpSchema) resolve(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref: %s", ref)
+	}
+	var node any = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unable to resolve $ref: %s", ref)
+		}
+		node, ok = m[part]
+		if !ok {
+			return nil, fmt.Errorf("unable to resolve $ref: %s", ref)
+		}
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unable to resolve $ref: %s", ref)
+	}
+	return m, nil
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// validate returns a list of errors, each prefixed with the path of the
+// invalid value
+func (s *xtpSchema) validate(path string, schema map[string]any, value any) []string {
+	nullable, _ := schema["nullable"].(bool)
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := s.resolve(ref)
+		if err != nil {
+			return []string{path + ": " + err.Error()}
+		}
+		schema = resolved
+		if n, _ := schema["nullable"].(bool); n {
+			nullable = true
+		}
+	}
+
+	if value == nil && nullable {
+		return nil
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		values := []string{}
+		for _, e := range enum {
+			values = append(values, fmt.Sprint(e))
+		}
+		return []string{fmt.Sprintf("%s: expected one of %s, got %v", path, strings.Join(values, ", "), value)}
+	}
+
+	typ, _ := schema["type"].(string)
+	if typ == "" {
+		if _, ok := schema["properties"]; ok {
+			typ = "object"
+		} else if _, ok := schema["items"]; ok {
+			typ = "array"
+		}
+	}
+
+	mismatch := func() []string {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, typ, jsonTypeName(value))}
+	}
+
+	format, _ := schema["format"].(string)
+	switch typ {
+	case "":
+		return nil
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return mismatch()
+		}
+		switch format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return []string{fmt.Sprintf("%s: expected an RFC 3339 date-time, got %q", path, str)}
+			}
+		case "byte":
+			if _, err := base64.StdEncoding.DecodeString(str); err != nil {
+				return []string{fmt.Sprintf("%s: expected base64 encoded bytes", path)}
+			}
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return []string{fmt.Sprintf("%s: expected integer, got %s", path, n)}
+		}
+		if format == "int32" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return []string{fmt.Sprintf("%s: %d is out of range for int32", path, i)}
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch()
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch()
+		}
+	case "buffer":
+		// Buffers are opaque bytes
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return mismatch()
+		}
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return nil
+		}
+		var errs []string
+		for i, item := range arr {
+			errs = append(errs, s.validate(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+		}
+		return errs
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		return s.validateObject(path, schema, obj)
+	default:
+		return []string{fmt.Sprintf("%s: unsupported schema type %s", path, typ)}
+	}
+	return nil
+}
+
+func (s *xtpSchema) validateObject(path string, schema map[string]any, obj map[string]any) []string {
+	var errs []string
+	properties, _ := schema["properties"].(map[string]any)
+	if list, ok := schema["properties"].([]any); ok {
+		// v0 schemas list properties by name
+		properties = map[string]any{}
+		for _, p := range list {
+			prop, _ := p.(map[string]any)
+			if name, _ := prop["name"].(string); name != "" {
+				properties[name] = prop
+			}
+		}
+	}
+
+	required := map[string]bool{}
+	if list, ok := schema["required"].([]any); ok {
+		for _, r := range list {
+			required[fmt.Sprint(r)] = true
+		}
+	} else {
+		for name, p := range properties {
+			prop, _ := p.(map[string]any)
+			if nullable, _ := prop["nullable"].(bool); !nullable {
+				required[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, _ := properties[name].(map[string]any)
+		value, ok := obj[name]
+		if !ok {
+			if required[name] {
+				errs = append(errs, fmt.Sprintf("%s.%s: missing required property", path, name))
+			}
+			continue
+		}
+		errs = append(errs, s.validate(path+"."+name, prop, value)...)
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		if _, ok := properties[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	switch additional := schema["additionalProperties"].(type) {
+	case map[string]any:
+		for _, k := range keys {
+			errs = append(errs, s.validate(path+"."+k, additional, obj[k])...)
+		}
+	case bool:
+		if !additional {
+			for _, k := range keys {
+				errs = append(errs, fmt.Sprintf("%s.%s: unexpected property", path, k))
+			}
+		}
+	}
+	return errs
+}
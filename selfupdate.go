@@ -0,0 +1,326 @@
+package cli
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v55/github"
+	"github.com/spf13/cobra"
+)
+
+type selfUpdateArgs struct {
+	args    []string
+	version string
+	sha256  string
+	path    string
+	force   bool
+}
+
+func (a *selfUpdateArgs) SetArgs(args []string) {
+	a.args = args
+}
+
+type versionArgs struct {
+	args  []string
+	check bool
+}
+
+func (a *versionArgs) SetArgs(args []string) {
+	a.args = args
+}
+
+// cliExecutableName is the name of the executable in release archives
+func cliExecutableName(osName string) string {
+	if osName == "windows" {
+		return "extism.exe"
+	}
+	return "extism"
+}
+
+// cliAssetName returns the release archive for a platform, e.g.
+// `extism-v1.5.0-linux-amd64.tar.gz`
+func cliAssetName(tag, osName, arch string) string {
+	ext := ".tar.gz"
+	if osName == "windows" {
+		ext = ".zip"
+	}
+	return "extism-" + tag + "-" + osName + "-" + arch + ext
+}
+
+// latestCliRelease returns the release with the highest version, pre-releases
+// are ignored
+func latestCliRelease(releases []*github.RepositoryRelease) (*github.RepositoryRelease, *semver.Version) {
+	var latest *github.RepositoryRelease
+	var latestVersion *semver.Version
+	for _, rel := range releases {
+		v, err := semver.NewVersion(rel.GetTagName())
+		if err != nil || rel.GetPrerelease() || rel.GetDraft() || v.Prerelease() != "" {
+			continue
+		}
+		if latestVersion == nil || v.GreaterThan(latestVersion) {
+			latest, latestVersion = rel, v
+		}
+	}
+	return latest, latestVersion
+}
+
+// findCliRelease returns the release matching version, or the latest release
+// when version is empty
+func findCliRelease(ctx context.Context, version string) (*github.RepositoryRelease, error) {
+	releases, err := cachedReleases(ctx, newCliReleaseSource())
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		rel, _ := latestCliRelease(releases)
+		if rel == nil {
+			return nil, errors.New("no releases found")
+		}
+		return rel, nil
+	}
+
+	for _, rel := range releases {
+		if strings.TrimPrefix(rel.GetTagName(), "v") == strings.TrimPrefix(version, "v") {
+			return rel, nil
+		}
+	}
+	return nil, errors.New("unable to find release " + version)
+}
+
+// cliChecksum returns the published sha256 of a release archive, only the
+// `<asset>.sha256` file or a combined checksum file are used since the per
+// asset files for other platforms may only contain a hash
+func cliChecksum(ctx context.Context, rel *github.RepositoryRelease, name string) (string, error) {
+	for _, asset := range rel.Assets {
+		assetName := asset.GetName()
+		if !isChecksumAsset(assetName, name) {
+			continue
+		}
+		if assetName != name+".sha256" && (strings.Contains(assetName, ".tar.gz") || strings.Contains(assetName, ".zip")) {
+			continue
+		}
+		Log("Fetching checksums from", asset.GetBrowserDownloadURL())
+		data, err := fetchChecksumFile(ctx, asset.GetBrowserDownloadURL())
+		if err != nil {
+			return "", err
+		}
+		if sum := parseChecksum(data, name); sum != "" {
+			return sum, nil
+		}
+	}
+	return "", nil
+}
+
+// extractExecutable reads the CLI executable from a release archive
+func extractExecutable(name string, data []byte, osName string) ([]byte, error) {
+	exe := cliExecutableName(osName)
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if filepath.Base(f.Name) != exe || f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		}
+		return nil, fmt.Errorf("%s not found in %s", exe, name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		item, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.Typeflag == tar.TypeReg && filepath.Base(item.Name) == exe {
+			return io.ReadAll(tr)
+		}
+	}
+	return nil, fmt.Errorf("%s not found in %s", exe, name)
+}
+
+// replaceExecutable atomically replaces the file at path, the new executable
+// is written next to it and renamed into place
+func replaceExecutable(path string, data []byte) error {
+	mode := os.FileMode(0o755)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".extism-update-*")
+	if err != nil {
+		return fmt.Errorf("unable to write to %s, you may need to run self-update using sudo: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	// A running executable can't be replaced on Windows, but it can be moved
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func runSelfUpdate(cmd *cobra.Command, updateArgs *selfUpdateArgs) error {
+	ctx := cmd.Context()
+	rel, err := findCliRelease(ctx, updateArgs.version)
+	if err != nil {
+		return err
+	}
+
+	tag := rel.GetTagName()
+	if sameVersion(tag, Version) && !updateArgs.force {
+		Print("extism", Version, "is already installed")
+		return nil
+	}
+
+	path := updateArgs.path
+	if path == "" {
+		path, err = os.Executable()
+		if err != nil {
+			return err
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+	}
+
+	name := cliAssetName(tag, runtime.GOOS, runtime.GOARCH)
+	var url string
+	for _, asset := range rel.Assets {
+		if asset.GetName() == name {
+			url = asset.GetBrowserDownloadURL()
+		}
+	}
+	if url == "" {
+		return fmt.Errorf("no release asset found matching %s in %s", name, tag)
+	}
+
+	expected := updateArgs.sha256
+	if expected == "" {
+		expected, err = cliChecksum(ctx, rel, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	Print("Fetching", url)
+	data, err := downloadAsset(ctx, url)
+	if err != nil {
+		return err
+	}
+	// The executable is only replaced with a verified release
+	if err := verifyChecksum(name, data, expected, true); errors.Is(err, errNoChecksum) {
+		return fmt.Errorf("%w, use --sha256 to provide one", err)
+	} else if err != nil {
+		return err
+	}
+
+	exe, err := extractExecutable(name, data, runtime.GOOS)
+	if err != nil {
+		return err
+	}
+	Log("Replacing", path)
+	if err := replaceExecutable(path, exe); err != nil {
+		return err
+	}
+	Print("Updated", path, "from", Version, "to", tag)
+	return nil
+}
+
+func runVersion(cmd *cobra.Command, versionArgs *versionArgs) error {
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, Version)
+	if !versionArgs.check {
+		return nil
+	}
+
+	releases, err := cachedReleases(cmd.Context(), newCliReleaseSource())
+	if err != nil {
+		return err
+	}
+	rel, latest := latestCliRelease(releases)
+	if rel == nil {
+		return errors.New("no releases found")
+	}
+
+	current, err := semver.NewVersion(Version)
+	if err != nil {
+		fmt.Fprintln(out, "Development build, the latest release is", rel.GetTagName())
+	} else if latest.GreaterThan(current) {
+		fmt.Fprintln(out, "A newer version is available:", rel.GetTagName()+", run `extism self-update` to install it")
+	} else {
+		fmt.Fprintln(out, "extism is up to date")
+	}
+	return nil
+}
+
+func SelfUpdateCmd() *cobra.Command {
+	updateArgs := &selfUpdateArgs{}
+	cmd := &cobra.Command{
+		Use:          "self-update",
+		Short:        "Update the extism CLI to the latest release",
+		Example:      "self-update\nself-update --version v1.5.0",
+		SilenceUsage: true,
+		RunE:         RunArgs(runSelfUpdate, updateArgs),
+		Args:         cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&updateArgs.version, "version", "", "Install a specific version instead of the latest release")
+	cmd.Flags().StringVar(&updateArgs.sha256, "sha256", "", "Expected sha256 of the release archive, by default the published checksum is used")
+	cmd.Flags().StringVar(&updateArgs.path, "path", "", "Executable to replace, defaults to the running executable")
+	cmd.Flags().BoolVar(&updateArgs.force, "force", false, "Reinstall even if the version is already installed")
+	return cmd
+}
+
+func VersionCmd() *cobra.Command {
+	versionArgs := &versionArgs{}
+	cmd := &cobra.Command{
+		Use:          "version",
+		Short:        "Print the version of the extism CLI",
+		SilenceUsage: true,
+		RunE:         RunArgs(runVersion, versionArgs),
+		Args:         cobra.NoArgs,
+	}
+	cmd.Flags().BoolVar(&versionArgs.check, "check", false, "Check whether a newer release is available")
+	return cmd
+}
@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	extism "github.com/extism/go-sdk"
+	"github.com/spf13/cobra"
+)
+
+// Signatures are detached ed25519 signatures of the raw module bytes, stored
+// base64 encoded next to the module with a `.sig` extension. Keys are PEM
+// encoded PKCS #8 private keys and PKIX public keys, the same format used by
+// `openssl genpkey -algorithm ed25519`.
+const signatureExt = ".sig"
+
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key %s: expected PEM encoded data", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key %s: %w", path, err)
+	}
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid private key %s: expected an ed25519 key", path)
+	}
+	return k, nil
+}
+
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key %s: expected PEM encoded data", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key %s: expected an ed25519 key", path)
+	}
+	return k, nil
+}
+
+func readPublicKeys(paths []string) ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for _, path := range paths {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func generateKey(path string) (ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	privData, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubData, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privData}), 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubData}), 0o644)
+	if err != nil {
+		return nil, err
+	}
+	Print("Generated", path, "and", path+".pub")
+	return priv, nil
+}
+
+func decodeSignature(data []byte) ([]byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return nil, errors.New("invalid signature: unexpected length")
+	}
+	return sig, nil
+}
+
+func verifySignature(keys []ed25519.PublicKey, data, sig []byte) bool {
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchSignature returns the signature for a module loaded from a URL, the
+// signature is downloaded from the module URL with `.sig` appended and cached
+// alongside the module. A cached signature is used unless refresh is set since
+// it's stored by the hash of the module it signs
+func (c *wasmCache) fetchSignature(ctx context.Context, u extism.WasmUrl, hash string, offline, refresh bool) ([]byte, error) {
+	path := c.path(hash) + signatureExt
+	if offline {
+		return os.ReadFile(path)
+	}
+	if !refresh {
+		if cached, err := os.ReadFile(path); err == nil {
+			Log("Using cached signature for", u.Url)
+			return cached, nil
+		}
+	}
+
+	sig := u
+	sig.Url = u.Url + signatureExt
+	sig.Hash = ""
+	data, err := downloadWasm(ctx, sig)
+	if err != nil {
+		if cached, cacheErr := os.ReadFile(path); cacheErr == nil {
+			Log("Unable to fetch", sig.Url, "using cached signature:", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	return data, writeFileAtomic(path, data, 0o644)
+}
+
+// verifyModules checks the signature of each module, modules is the list of
+// modules from the manifest and resolved contains the same modules after URLs
+// have been fetched. Files are read before verification and returned as
+// in-memory data so the verified bytes are exactly the bytes that are loaded
+func (a *callArgs) verifyModules(ctx context.Context, modules, resolved []extism.Wasm) ([]extism.Wasm, error) {
+	if len(a.trustedKeys) == 0 {
+		return nil, errors.New("--require-signature needs at least one --trusted-key")
+	}
+	keys, err := readPublicKeys(a.trustedKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := make([]extism.Wasm, 0, len(resolved))
+	for i, w := range modules {
+		var name string
+		var data, sig []byte
+		switch w := w.(type) {
+		case extism.WasmFile:
+			name = w.Path
+			data, err = os.ReadFile(w.Path)
+			if err != nil {
+				return nil, err
+			}
+			sig, err = os.ReadFile(w.Path + signatureExt)
+			if err != nil {
+				return nil, fmt.Errorf("module %s is not signed: %w", name, err)
+			}
+			resolved[i] = extism.WasmData{Data: data, Hash: w.Hash, Name: w.Name}
+		case extism.WasmUrl:
+			name = w.Url
+			data = resolved[i].(extism.WasmData).Data
+			cache, err := newWasmCache()
+			if err != nil {
+				return nil, err
+			}
+			sig, err = cache.fetchSignature(ctx, w, sha256Hex(data), a.offline, a.refresh)
+			if err != nil {
+				return nil, fmt.Errorf("module %s is not signed: %w", name, err)
+			}
+		default:
+			return nil, errors.New("only modules loaded from a file or URL can be verified")
+		}
+
+		decoded, err := decodeSignature(sig)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+		if !verifySignature(keys, data, decoded) {
+			return nil, fmt.Errorf("signature verification failed for module %s", name)
+		}
+		Log("Verified signature for", name)
+		verified = append(verified, resolved[i])
+	}
+	return verified, nil
+}
+
+type signArgs struct {
+	args        []string
+	key         string
+	generateKey string
+}
+
+func (a *signArgs) SetArgs(args []string) {
+	a.args = args
+}
+
+func runSign(cmd *cobra.Command, sign *signArgs) error {
+	var key ed25519.PrivateKey
+	var err error
+	if sign.generateKey != "" {
+		key, err = generateKey(sign.generateKey)
+	} else if sign.key != "" {
+		key, err = readPrivateKey(sign.key)
+	} else if len(sign.args) > 0 {
+		return errors.New("a signing key is required, use --key or --generate-key")
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, path := range sign.args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+		if err := os.WriteFile(path+signatureExt, []byte(sig+"\n"), 0o644); err != nil {
+			return err
+		}
+		Print("Signed", path, "->", path+signatureExt)
+	}
+	return nil
+}
+
+func SignCmd() *cobra.Command {
+	sign := &signArgs{}
+	cmd := &cobra.Command{
+		Use:          "sign [flags] wasm_file...",
+		Short:        "Create detached ed25519 signatures for Wasm modules",
+		SilenceUsage: true,
+		RunE:         RunArgs(runSign, sign),
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&sign.key, "key", "", "PEM encoded ed25519 private key used to sign")
+	flags.StringVar(&sign.generateKey, "generate-key", "", "Generate a new key pair, the private key is written to the given path and the public key to PATH.pub")
+	cmd.MarkFlagsMutuallyExclusive("key", "generate-key")
+	return cmd
+}
+
+type verifyArgs struct {
+	callArgs
+}
+
+func runVerify(cmd *cobra.Command, verify *verifyArgs) error {
+	modules := []extism.Wasm{}
+	for _, path := range verify.args {
+		if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+			modules = append(modules, extism.WasmUrl{Url: path})
+		} else {
+			modules = append(modules, extism.WasmFile{Path: path})
+		}
+	}
+
+	resolved, err := resolveWasm(cmd.Context(), modules, verify.offline, verify.refresh)
+	if err != nil {
+		return err
+	}
+
+	_, err = verify.verifyModules(cmd.Context(), modules, resolved)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range verify.args {
+		Print("Verified", path)
+	}
+	return nil
+}
+
+func VerifyCmd() *cobra.Command {
+	verify := &verifyArgs{}
+	cmd := &cobra.Command{
+		Use:          "verify [flags] wasm_file...",
+		Short:        "Verify the signatures of Wasm modules",
+		SilenceUsage: true,
+		RunE:         RunArgs(runVerify, verify),
+		Args:         cobra.MinimumNArgs(1),
+	}
+	flags := cmd.Flags()
+	flags.StringArrayVar(&verify.trustedKeys, "trusted-key", []string{}, "PEM encoded ed25519 public key, may be repeated")
+	flags.BoolVar(&verify.offline, "offline", false, "Only use cached modules and signatures for URLs")
+	flags.BoolVar(&verify.refresh, "refresh", false, "Download modules and signatures for URLs again even if they're cached")
+	cmd.MarkFlagRequired("trusted-key")
+	return cmd
+}
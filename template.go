@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// templateSpecFile is an optional file in the root of a PDK template that
+// describes the template variables and the commands to run after generating
+const templateSpecFile = "extism-template.json"
+
+type templateVariable struct {
+	Name    string `json:"name"`
+	Prompt  string `json:"prompt,omitempty"`
+	Default string `json:"default,omitempty"`
+}
+
+type templateSpec struct {
+	Variables []templateVariable `json:"variables,omitempty"`
+	Hooks     []string           `json:"hooks,omitempty"`
+}
+
+// Variables available to every template, templates can override the defaults
+// or add a prompt by declaring a variable with the same name
+var builtinTemplateVariables = []templateVariable{
+	{Name: "project_name"},
+	{Name: "module_path", Default: "{{project_name}}"},
+	{Name: "author"},
+	{Name: "license", Default: "BSD-3-Clause"},
+}
+
+func readTemplateSpec(dir string) (templateSpec, error) {
+	var spec templateSpec
+	data, err := os.ReadFile(filepath.Join(dir, templateSpecFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return spec, nil
+	} else if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("invalid %s: %w", templateSpecFile, err)
+	}
+	return spec, nil
+}
+
+// parseTemplateVars parses `--var` arguments in KEY=VALUE format
+func parseTemplateVars(vars []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, v := range vars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid value for --var flag: %s, expected KEY=VALUE", v)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func gitAuthor() string {
+	out, err := exec.Command("git", "config", "user.name").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func substituteTemplate(s string, values map[string]string) string {
+	for k, v := range values {
+		s = strings.ReplaceAll(s, "{{"+k+"}}", v)
+	}
+	return s
+}
+
+// templateValues resolves the value of each template variable, using `--var`
+// first, then prompting when attached to a terminal and finally the default.
+// Defaults may refer to variables declared before them.
+func templateValues(dir string, spec templateSpec, vars []string) (map[string]string, error) {
+	values, err := parseTemplateVars(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := append([]templateVariable{}, builtinTemplateVariables...)
+	for _, v := range spec.Variables {
+		found := false
+		for i := range variables {
+			if variables[i].Name == v.Name {
+				variables[i] = v
+				found = true
+			}
+		}
+		if !found {
+			variables = append(variables, v)
+		}
+	}
+
+	defaults := map[string]string{
+		"project_name": filepath.Base(absDir),
+		"author":       gitAuthor(),
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	scanner := bufio.NewScanner(os.Stdin)
+	resolved := map[string]string{}
+	for _, v := range variables {
+		if value, ok := values[v.Name]; ok {
+			resolved[v.Name] = value
+			continue
+		}
+
+		def := v.Default
+		if def == "" {
+			def = defaults[v.Name]
+		}
+		def = substituteTemplate(def, resolved)
+
+		if v.Prompt != "" && interactive {
+			fmt.Printf("%s [%s]: ", v.Prompt, def)
+			if scanner.Scan() {
+				if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+					def = answer
+				}
+			}
+		}
+		resolved[v.Name] = def
+	}
+
+	// Variables that aren't declared by the template are still substituted
+	for k, v := range values {
+		resolved[k] = v
+	}
+	return resolved, nil
+}
+
+// applyTemplate substitutes template variables in the contents and paths of
+// all files in dir
+func applyTemplate(dir string, values map[string]string) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if path != dir {
+			paths = append(paths, path)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Skip binary files
+		if bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+		out := substituteTemplate(string(data), values)
+		if out == string(data) {
+			return nil
+		}
+		Log("Substituting template variables in", path)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(out), info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+
+	// Rename the deepest paths first so parent directories are still valid
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+	for _, path := range paths {
+		name := filepath.Base(path)
+		renamed := substituteTemplate(name, values)
+		if renamed == name {
+			continue
+		}
+		Log("Renaming", path, "to", renamed)
+		if err := os.Rename(path, filepath.Join(filepath.Dir(path), renamed)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareTemplate applies the template variables to a generated project and
+// removes the template spec, the spec is returned so hooks can be run once the
+// project is ready
+func prepareTemplate(dir string, vars []string) (templateSpec, map[string]string, error) {
+	spec, err := readTemplateSpec(dir)
+	if err != nil {
+		return spec, nil, err
+	}
+
+	values, err := templateValues(dir, spec, vars)
+	if err != nil {
+		return spec, nil, err
+	}
+
+	if err := os.Remove(filepath.Join(dir, templateSpecFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return spec, nil, err
+	}
+
+	return spec, values, applyTemplate(dir, values)
+}
+
+// runTemplateHooks runs the post-generate commands listed in the template spec.
+// The commands are shown before running them and need to be confirmed, when
+// not running in a terminal they're skipped unless allowHooks is set.
+func runTemplateHooks(dir string, spec templateSpec, values map[string]string, allowHooks, noHooks bool) error {
+	var commands [][]string
+	for _, hook := range spec.Hooks {
+		if args := strings.Fields(substituteTemplate(hook, values)); len(args) > 0 {
+			commands = append(commands, args)
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	fmt.Println("The template runs the following commands after generating:")
+	for _, args := range commands {
+		fmt.Println("  " + strings.Join(args, " "))
+	}
+	if noHooks {
+		fmt.Println("Skipping post-generate commands")
+		return nil
+	}
+	if !allowHooks {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Println("Skipping post-generate commands, use --allow-hooks to run them")
+			return nil
+		}
+		fmt.Print("Run these commands? [y/N]: ")
+		scanner := bufio.NewScanner(os.Stdin)
+		answer := ""
+		if scanner.Scan() {
+			answer = strings.ToLower(strings.TrimSpace(scanner.Text()))
+		}
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Skipping post-generate commands")
+			return nil
+		}
+	}
+
+	for _, args := range commands {
+		Print("Running", strings.Join(args, " "))
+		if err := runCmdInDir(dir, args[0], args[1:]...); err != nil {
+			return fmt.Errorf("post-generate command '%s' failed: %w", strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// templateCache stores PDK templates for offline use, each template is stored
+// without git metadata at `<hash of url>/<tag>` along with a `<tag>.json` file
+// describing the cached copy
+type templateCache struct {
+	dir string
+}
+
+type templateCacheEntry struct {
+	Name    string    `json:"name"`
+	Url     string    `json:"url"`
+	Tag     string    `json:"tag"`
+	Commit  string    `json:"commit,omitempty"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func newTemplateCache() (*templateCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "templates")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &templateCache{dir: dir}, nil
+}
+
+func (c *templateCache) repoDir(pdk pdkTemplate) string {
+	return filepath.Join(c.dir, sha256Hex([]byte(pdk.Url))[:16])
+}
+
+func (c *templateCache) path(pdk pdkTemplate, tag string) string {
+	return filepath.Join(c.repoDir(pdk), url.PathEscape(tag))
+}
+
+// tags lists the tags cached for a template
+func (c *templateCache) tags(pdk pdkTemplate) []string {
+	tags := []string{}
+	files, _ := filepath.Glob(filepath.Join(c.repoDir(pdk), "*.json"))
+	for _, f := range files {
+		if entry, ok := c.readEntry(f); ok && entry.Url == pdk.Url {
+			tags = append(tags, entry.Tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (c *templateCache) readEntry(path string) (templateCacheEntry, bool) {
+	var entry templateCacheEntry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		Log("Ignoring invalid template cache entry:", path, err)
+		return entry, false
+	}
+	return entry, true
+}
+
+// get returns the path of the cached template, the cached tag has to match the
+// requested tag
+func (c *templateCache) get(pdk pdkTemplate, tag string) (string, error) {
+	path := c.path(pdk, tag)
+	entry, ok := c.readEntry(path + ".json")
+	if ok && entry.Url == pdk.Url && entry.Tag == tag {
+		if _, err := os.Stat(path); err == nil {
+			Log("Using cached template", pdk.Name, "at", tag, "fetched", entry.Fetched.Format(time.RFC3339))
+			return path, nil
+		}
+	}
+
+	lang := strings.ToLower(pdk.Name)
+	if tags := c.tags(pdk); len(tags) > 0 {
+		return "", fmt.Errorf("%s template is cached at tag %s but --tag is %s, run `extism generate fetch --tag %s %s` to cache it", pdk.Name, strings.Join(tags, ", "), tag, tag, lang)
+	}
+	return "", fmt.Errorf("%s template is not cached, run `extism generate fetch --tag %s %s` to cache it", pdk.Name, tag, lang)
+}
+
+// fetch clones a template into the cache, templates that are already cached
+// are only updated when refresh is set
+func (c *templateCache) fetch(pdk pdkTemplate, tag string, refresh bool) error {
+	if _, ok := localTemplateDir(pdk.Url); ok {
+		Print("Skipping", pdk.Name, "template, local templates are not cached")
+		return nil
+	}
+
+	if !refresh {
+		if _, err := c.get(pdk, tag); err == nil {
+			Print(pdk.Name, "template is already cached at", tag+", use --refresh to update it")
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(c.repoDir(pdk), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(c.repoDir(pdk), ".fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	Print("Fetching", pdk.Name, "template at", tag)
+	if err := runCmdInDir("", "git", "clone", "--depth=1", pdk.Url, "--branch", tag, "--recurse-submodules", tmp); err != nil {
+		return err
+	}
+
+	entry := templateCacheEntry{Name: pdk.Name, Url: pdk.Url, Tag: tag, Fetched: time.Now().UTC()}
+	if out, err := exec.Command("git", "-C", tmp, "rev-parse", "HEAD").Output(); err == nil {
+		entry.Commit = strings.TrimSpace(string(out))
+	}
+
+	if err := removeGitMetadata(tmp); err != nil {
+		return err
+	}
+
+	path := c.path(pdk, tag)
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path+".json", data, 0o644)
+}
+
+// removeGitMetadata removes the repository and submodule metadata from a clone
+func removeGitMetadata(dir string) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			paths = append(paths, path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchTemplates caches the templates for the given languages, or all templates
+// when no language is given
+func fetchTemplates(gen *generateArgs, langs []string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("missing `git`, please install before executing this command")
+	}
+
+	templates, err := loadPdkTemplates(gen.templates, false)
+	if err != nil {
+		return err
+	}
+
+	selected := templates
+	if len(langs) > 0 {
+		selected = []pdkTemplate{}
+		for _, lang := range langs {
+			found := false
+			for _, tmpl := range templates {
+				if tmpl.matches(strings.ToLower(lang)) {
+					selected = append(selected, tmpl)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unsupported template: '%s'", lang)
+			}
+		}
+	}
+
+	cache, err := newTemplateCache()
+	if err != nil {
+		return err
+	}
+	for _, tmpl := range selected {
+		if err := cache.fetch(tmpl, gen.tag, gen.refresh); err != nil {
+			return fmt.Errorf("unable to fetch %s template: %w", tmpl.Name, err)
+		}
+	}
+	return nil
+}
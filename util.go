@@ -12,6 +12,9 @@ var LoggingEnabled = false
 var PrintingDisabled = false
 var GithubToken = ""
 
+// Version is the version of the CLI, it's set by the `extism` command
+var Version = "dev"
+
 type Args interface {
 	SetArgs(args []string)
 }
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// vendorLockFile records the vendored assets so the same files can be fetched
+// again, it's written to the root of the vendor directory
+const vendorLockFile = "extism.lock"
+
+type libVendorArgs struct {
+	args     []string
+	version  string
+	triplets []string
+	dir      string
+	mirror   string
+
+	skipChecksum bool
+}
+
+func (a *libVendorArgs) SetArgs(args []string) {
+	a.args = args
+}
+
+type vendorLock struct {
+	Version string        `json:"version"`
+	Updated time.Time     `json:"updated"`
+	Assets  []vendorAsset `json:"assets"`
+}
+
+type vendorAsset struct {
+	Triplet string `json:"triplet"`
+	Name    string `json:"name"`
+	Url     string `json:"url"`
+	Sha256  string `json:"sha256"`
+}
+
+func readVendorLock(dir string) (*vendorLock, error) {
+	path := filepath.Join(dir, vendorLockFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock vendorLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+func writeVendorLock(dir string, lock *vendorLock) error {
+	sort.Slice(lock.Assets, func(i, j int) bool {
+		return lock.Assets[i].Triplet < lock.Assets[j].Triplet
+	})
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, vendorLockFile)
+	Log("Writing lockfile", path)
+	return writeFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+// vendorTarball extracts a release tarball to `<dir>/<triplet>`, libraries and
+// pkg-config files are installed to `lib` and headers to `include`
+func vendorTarball(dir, triplet string, data []byte) error {
+	if strings.ContainsAny(triplet, `/\`) || strings.Contains(triplet, "..") {
+		return fmt.Errorf("invalid triplet: %s", triplet)
+	}
+	arch, osName, libc, err := parseTriplet(triplet)
+	if err != nil {
+		return err
+	}
+
+	root := filepath.Join(dir, triplet)
+	if err := os.RemoveAll(root); err != nil {
+		return err
+	}
+
+	// pkg-config files are relative to their own location so the vendor
+	// directory can be moved
+	installArgs := &libInstallArgs{
+		libArgs: libArgs{prefix: "${pcfiledir}/..", libDir: "lib", includeDir: "include"},
+		os:      osName,
+		arch:    arch,
+		libc:    libc,
+	}
+	libDir := filepath.Join(root, "lib")
+	if err := extractLibrary(bytes.NewReader(data), installArgs, libDir); err != nil {
+		return err
+	}
+
+	headers, err := filepath.Glob(filepath.Join(libDir, "*.h"))
+	if err != nil {
+		return err
+	}
+	includeDir := filepath.Join(root, "include")
+	if err := os.MkdirAll(includeDir, 0o755); err != nil {
+		return err
+	}
+	for _, header := range headers {
+		if err := os.Rename(header, filepath.Join(includeDir, filepath.Base(header))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveVendorAsset finds the release asset for a triplet and its published
+// checksum
+func resolveVendorAsset(ctx context.Context, vendorArgs *libVendorArgs, version, triplet string) (vendorAsset, string, error) {
+	arch, osName, libc, err := parseTriplet(triplet)
+	if err != nil {
+		return vendorAsset{}, "", err
+	}
+	prefix, err := assetPrefix(osName, arch, libc)
+	if err != nil {
+		return vendorAsset{}, "", err
+	}
+
+	if vendorArgs.mirror != "" {
+		assetVersion := version
+		if version == "latest" {
+			assetVersion = "main"
+		}
+		name := prefix + "-" + assetVersion + ".tar.gz"
+		url := strings.TrimSuffix(vendorArgs.mirror, "/") + "/" + version + "/" + name
+		expected, err := mirrorChecksum(ctx, url, name)
+		return vendorAsset{Triplet: triplet, Name: name, Url: url}, expected, err
+	}
+
+	rel, err := findRelease(ctx, version)
+	if err != nil {
+		return vendorAsset{}, "", err
+	}
+	for _, asset := range rel.Assets {
+		if strings.HasPrefix(asset.GetName(), prefix) && strings.HasSuffix(asset.GetName(), ".tar.gz") {
+			expected, err := releaseChecksum(ctx, rel, asset.GetName())
+			return vendorAsset{Triplet: triplet, Name: asset.GetName(), Url: asset.GetBrowserDownloadURL()}, expected, err
+		}
+	}
+	return vendorAsset{}, "", errors.New("No release asset found matching " + prefix + " in " + rel.GetTagName())
+}
+
+// runLibVendor fetches libextism for each triplet into the vendor directory
+// and adds them to the lockfile. Without any triplets the assets listed in an
+// existing lockfile are fetched again and must match their recorded checksums.
+func runLibVendor(cmd *cobra.Command, vendorArgs *libVendorArgs) error {
+	ctx := cmd.Context()
+	if len(vendorArgs.triplets) == 0 {
+		lock, err := readVendorLock(vendorArgs.dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("no triplets specified and no " + vendorLockFile + " found in " + vendorArgs.dir + ", use --triplet to select targets")
+		} else if err != nil {
+			return err
+		}
+
+		Print("Vendoring", lock.Version, "from", filepath.Join(vendorArgs.dir, vendorLockFile))
+		for _, asset := range lock.Assets {
+			Print("Fetching", asset.Url)
+			data, err := downloadAsset(ctx, asset.Url)
+			if err != nil {
+				return err
+			}
+			if err := verifyChecksum(asset.Name, data, asset.Sha256, true); err != nil {
+				return err
+			}
+			if err := vendorTarball(vendorArgs.dir, asset.Triplet, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	version := vendorArgs.version
+	if version == "git" {
+		version = "latest"
+	}
+	if version == "" {
+		if vendorArgs.mirror != "" {
+			return errors.New("--version is required when vendoring from a mirror")
+		}
+		rel, err := findRelease(ctx, "")
+		if err != nil {
+			return err
+		}
+		version = rel.GetTagName()
+	}
+	if err := validLibVersion(version); err != nil {
+		return err
+	}
+
+	// Triplets that were vendored before are kept in the lockfile, they're
+	// fetched again when the version changes so all targets match
+	triplets := vendorArgs.triplets
+	lock := &vendorLock{Version: version, Assets: []vendorAsset{}}
+	existing, err := readVendorLock(vendorArgs.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if existing != nil {
+		for _, asset := range existing.Assets {
+			if slices.Contains(triplets, asset.Triplet) {
+				continue
+			}
+			if existing.Version == version {
+				lock.Assets = append(lock.Assets, asset)
+			} else {
+				Print("Updating", asset.Triplet, "from", existing.Version, "to", version)
+				triplets = append(triplets, asset.Triplet)
+			}
+		}
+	}
+
+	for _, triplet := range triplets {
+		asset, expected, err := resolveVendorAsset(ctx, vendorArgs, version, triplet)
+		if err != nil {
+			return err
+		}
+
+		Print("Fetching", asset.Url)
+		data, err := downloadAsset(ctx, asset.Url)
+		if err != nil {
+			return err
+		}
+		if err := verifyChecksum(asset.Name, data, expected, !vendorArgs.skipChecksum); errors.Is(err, errNoChecksum) {
+			return fmt.Errorf("%w, use --skip-checksum to vendor it without verifying it", err)
+		} else if err != nil {
+			return err
+		}
+		Print("Vendoring", asset.Name, "to", filepath.Join(vendorArgs.dir, triplet))
+		if err := vendorTarball(vendorArgs.dir, triplet, data); err != nil {
+			return err
+		}
+		asset.Sha256 = sha256Hex(data)
+		lock.Assets = append(lock.Assets, asset)
+	}
+
+	lock.Updated = time.Now().UTC()
+	return writeVendorLock(vendorArgs.dir, lock)
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+)
+
+func (a *callArgs) getEnv() map[string]string {
+	env := map[string]string{}
+	for _, e := range a.env {
+		split := strings.SplitN(e, "=", 2)
+		if len(split) == 1 {
+			env[e] = ""
+		} else {
+			env[split[0]] = split[1]
+		}
+	}
+	return env
+}
+
+// openFile opens a file used for WASI stdio, files are only opened once per
+// command so output isn't truncated when a plugin is re-created
+func (a *callArgs) openFile(path string, flag int) (*os.File, error) {
+	if a.files == nil {
+		a.files = map[string]*os.File{}
+	}
+	if f, ok := a.files[path]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	a.files[path] = f
+	return f, nil
+}
+
+func (a *callArgs) closeFiles() {
+	for path, f := range a.files {
+		f.Close()
+		delete(a.files, path)
+	}
+}
+
+func (a *callArgs) hasWasiOptions() bool {
+	return len(a.env) > 0 || len(a.wasiArgs) > 0 || a.wasiStdin != "" || a.wasiStdout != "" || a.wasiStderr != ""
+}
+
+func (a *callArgs) getModuleConfig() (wazero.ModuleConfig, error) {
+	config := wazero.NewModuleConfig().WithSysWalltime()
+	if !a.wasi {
+		if a.hasWasiOptions() {
+			return config, errors.New("WASI options require the --wasi flag")
+		}
+		return config, nil
+	}
+
+	for k, v := range a.getEnv() {
+		Log("Setting WASI environment variable", k)
+		config = config.WithEnv(k, v)
+	}
+
+	if len(a.wasiArgs) > 0 {
+		Log("Setting WASI arguments:", a.wasiArgs)
+		config = config.WithArgs(a.wasiArgs...)
+	}
+
+	if a.wasiStdin != "" {
+		Log("Reading WASI stdin from", a.wasiStdin)
+		f, err := a.openFile(a.wasiStdin, os.O_RDONLY)
+		if err != nil {
+			return config, err
+		}
+		config = config.WithStdin(f)
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	if a.wasiStdout != "" {
+		Log("Writing WASI stdout to", a.wasiStdout)
+		f, err := a.openFile(a.wasiStdout, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+		if err != nil {
+			return config, err
+		}
+		stdout = f
+	}
+
+	if a.wasiStderr != "" {
+		Log("Writing WASI stderr to", a.wasiStderr)
+		f, err := a.openFile(a.wasiStderr, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+		if err != nil {
+			return config, err
+		}
+		stderr = f
+	}
+
+	return config.WithStdout(stdout).WithStderr(stderr), nil
+}